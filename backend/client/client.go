@@ -0,0 +1,318 @@
+// Package client talks to the Dislaunch daemon over its socket,
+// through the daemon's JSON-RPC methods.
+//
+// A `Client` may be used by several goroutines at once. Each method
+// is answered once whatever it started has finished, whilst the
+// daemon's state is sent on `Updates` as it changes.
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json/jsontext"
+	"encoding/json/v2"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// The version of the protocol the client speaks, which the daemon's
+// must be at least
+const ProtocolVersion = 1
+
+// The command run by `Discover`, which must be in `PATH` unless
+// this is set to its path
+var Executable = "dislaunchd"
+
+var ErrClosed = errors.New("connection to daemon closed")
+
+// Error codes the daemon answers with besides those of JSON-RPC itself
+const (
+	CodeInvalidParams = -32602
+	// The process a request started finished with an error
+	CodeProcessFailed = -32000
+	// The release is in a fatal state, so no process can be started
+	CodeFatal = -32001
+)
+
+// An error the daemon answered a request with
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (err *Error) Error() string {
+	return err.Message
+}
+
+type Hello struct {
+	DaemonVersion   string   `json:"daemon_version"`
+	ProtocolVersion int      `json:"protocol_version"`
+	Capabilities    []string `json:"capabilities"`
+}
+
+type request struct {
+	JsonRpc string         `json:"jsonrpc"`
+	Id      uint64         `json:"id"`
+	Method  string         `json:"method"`
+	Params  jsontext.Value `json:"params,omitzero"`
+}
+
+// Anything the daemon sends: responses, notifications and, having
+// no `jsonrpc` member, states
+type message struct {
+	JsonRpc string         `json:"jsonrpc"`
+	Id      jsontext.Value `json:"id"`
+	Method  string         `json:"method"`
+	Result  jsontext.Value `json:"result"`
+	Error   *Error         `json:"error"`
+}
+
+type Client struct {
+	conn  net.Conn
+	hello Hello
+
+	writeMu sync.Mutex
+	mu      sync.Mutex
+	next    uint64
+	pending map[uint64]chan message
+
+	updates chan State
+	closed  chan struct{}
+	once    sync.Once
+	err     error // why the connection closed, once it has
+}
+
+// `Discover` returns the path of the daemon's socket, starting the
+// daemon if it isn't running, as `dislaunchd path` does
+func Discover(ctx context.Context) (string, error) {
+	output, err := exec.CommandContext(ctx, Executable, "path").Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) != 0 {
+			return "", fmt.Errorf("error getting path of daemon socket: %s", strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return "", fmt.Errorf("error getting path of daemon socket: %w", err)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// `Connect` connects to the daemon, starting it if it isn't running
+func Connect(ctx context.Context) (*Client, error) {
+	socket, err := Discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return Dial(ctx, socket)
+}
+
+// `Dial` connects to the daemon at `socket`, making sure that it
+// speaks a compatible protocol
+func Dial(ctx context.Context, socket string) (*Client, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "unix", socket)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to daemon at '%s': %w", socket, err)
+	}
+
+	client := &Client{
+		conn:    conn,
+		pending: make(map[uint64]chan message),
+		updates: make(chan State, 1),
+		closed:  make(chan struct{}),
+	}
+	go client.read()
+
+	var hello struct {
+		Hello
+		Compatible bool `json:"compatible"`
+	}
+	if err = client.call(ctx, "hello", map[string]any{
+		"client":           filepath.Base(os.Args[0]),
+		"protocol_version": ProtocolVersion,
+	}, &hello); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("error greeting daemon: %w", err)
+	}
+	if !hello.Compatible {
+		client.Close()
+		return nil, fmt.Errorf("daemon speaks protocol version %d, but at least %d is needed", hello.ProtocolVersion, ProtocolVersion)
+	}
+	client.hello = hello.Hello
+	return client, nil
+}
+
+// `Hello` describes the daemon, as of connecting to it
+func (client *Client) Hello() Hello {
+	return client.hello
+}
+
+// `Updates` receives the daemon's state whenever it changes,
+// starting with the whole state as of connecting. Only the latest
+// state is kept until it's received, so a slow receiver skips
+// states rather than holding up the client. It's closed along with
+// the connection.
+func (client *Client) Updates() <-chan State {
+	return client.updates
+}
+
+// `Close` closes the connection. Processes the daemon is running
+// on behalf of the client carry on regardless.
+func (client *Client) Close() error {
+	client.fail(ErrClosed)
+	return client.conn.Close()
+}
+
+// `Err` returns why the connection closed, or `nil` if it's still open
+func (client *Client) Err() error {
+	select {
+	case <-client.closed:
+		return client.err
+	default:
+		return nil
+	}
+}
+
+// `fail` closes the client because of `err`, if it isn't already
+func (client *Client) fail(err error) {
+	client.once.Do(func() {
+		client.err = err
+		close(client.closed)
+	})
+}
+
+// `read` reads everything the daemon sends, handing responses to
+// their requests and states to `updates`
+func (client *Client) read() {
+	defer close(client.updates)
+
+	reader := bufio.NewReader(client.conn)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			client.fail(fmt.Errorf("error reading from daemon: %w", err))
+			client.conn.Close()
+			return
+		}
+
+		var message message
+		if err = json.Unmarshal(line, &message); err != nil {
+			client.fail(fmt.Errorf("error decoding message from daemon: %w", err))
+			client.conn.Close()
+			return
+		}
+
+		switch {
+		case message.JsonRpc == "":
+			var state State
+			if err = json.Unmarshal(line, &state); err != nil {
+				client.fail(fmt.Errorf("error decoding backend state: %w", err))
+				client.conn.Close()
+				return
+			}
+			client.update(state)
+		case message.Method != "":
+			// notifications such as the greeting are of no use to the client
+		default:
+			id, err := strconv.ParseUint(string(bytes.TrimSpace(message.Id)), 10, 64)
+			if err != nil {
+				continue // not in answer to this client
+			}
+			client.mu.Lock()
+			response, exists := client.pending[id]
+			delete(client.pending, id)
+			client.mu.Unlock()
+			if exists {
+				response <- message
+			}
+		}
+	}
+}
+
+// `update` replaces whichever state hasn't yet been received with
+// `state`. Only `read` sends on `updates`, so this never blocks.
+func (client *Client) update(state State) {
+	select {
+	case client.updates <- state:
+		return
+	default:
+	}
+	select {
+	case <-client.updates:
+	default:
+	}
+	client.updates <- state
+}
+
+// `call` makes a request of the daemon and waits for its response,
+// decoding its result into `result` unless `nil`
+func (client *Client) call(ctx context.Context, method string, params any, result any) error {
+	request := request{JsonRpc: "2.0", Method: method}
+	if params != nil {
+		var err error
+		if request.Params, err = json.Marshal(params); err != nil {
+			return fmt.Errorf("error encoding request '%s': %w", method, err)
+		}
+	}
+
+	response := make(chan message, 1)
+	client.mu.Lock()
+	client.next++
+	request.Id = client.next
+	client.pending[request.Id] = response
+	client.mu.Unlock()
+	defer func() {
+		client.mu.Lock()
+		delete(client.pending, request.Id)
+		client.mu.Unlock()
+	}()
+
+	buffer, err := json.Marshal(request, json.OmitZeroStructFields(true))
+	if err != nil {
+		return fmt.Errorf("error encoding request '%s': %w", method, err)
+	}
+	client.writeMu.Lock()
+	_, err = client.conn.Write(append(buffer, '\n'))
+	client.writeMu.Unlock()
+	if err != nil {
+		if err := client.Err(); err != nil {
+			return err
+		}
+		return fmt.Errorf("error writing request '%s' to daemon: %w", method, err)
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-client.closed:
+		// the response may have been read just before the connection closed
+		select {
+		case message := <-response:
+			return decodeResult(method, message, result)
+		default:
+			return client.err
+		}
+	case message := <-response:
+		return decodeResult(method, message, result)
+	}
+}
+
+func decodeResult(method string, message message, result any) error {
+	if message.Error != nil {
+		return message.Error
+	}
+	if result == nil {
+		return nil
+	}
+	if err := json.Unmarshal(message.Result, result); err != nil {
+		return fmt.Errorf("error decoding result of '%s': %w", method, err)
+	}
+	return nil
+}
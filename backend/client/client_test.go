@@ -0,0 +1,254 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json/v2"
+	"errors"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// A daemon that the test speaks for, over a real socket
+type fakeDaemon struct {
+	t      *testing.T
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+type dialResult struct {
+	client *Client
+	err    error
+}
+
+// `dial` connects a client to a fake daemon, which greets it and
+// answers its hello with `compatible`
+func dial(t *testing.T, compatible bool) (*fakeDaemon, dialResult) {
+	t.Helper()
+
+	socket := filepath.Join(t.TempDir(), "dislaunch.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+	dialed := make(chan dialResult, 1)
+	go func() {
+		client, err := Dial(ctx, socket)
+		dialed <- dialResult{client, err}
+	}()
+
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		conn.Close()
+	})
+	daemon := &fakeDaemon{t: t, conn: conn, reader: bufio.NewReader(conn)}
+
+	hello := Hello{DaemonVersion: "test", ProtocolVersion: ProtocolVersion, Capabilities: []string{"json_rpc"}}
+	daemon.send(map[string]any{"jsonrpc": "2.0", "method": "hello", "params": hello})
+	daemon.send(State{Stable: &Release{Message: "greeting"}})
+
+	request := daemon.read()
+	if request.Method != "hello" {
+		t.Fatalf("first request is '%s', want 'hello'", request.Method)
+	}
+	daemon.respond(request, struct {
+		Hello
+		Compatible bool `json:"compatible"`
+	}{hello, compatible})
+
+	result := <-dialed
+	if result.client != nil {
+		t.Cleanup(func() {
+			result.client.Close()
+		})
+	}
+	return daemon, result
+}
+
+func (daemon *fakeDaemon) send(message any) {
+	daemon.t.Helper()
+
+	buffer, err := json.Marshal(message)
+	if err != nil {
+		daemon.t.Fatal(err)
+	}
+	if _, err = daemon.conn.Write(append(buffer, '\n')); err != nil {
+		daemon.t.Fatal(err)
+	}
+}
+
+func (daemon *fakeDaemon) read() request {
+	daemon.t.Helper()
+
+	if err := daemon.conn.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		daemon.t.Fatal(err)
+	}
+	line, err := daemon.reader.ReadBytes('\n')
+	if err != nil {
+		daemon.t.Fatalf("error reading request: %s", err)
+	}
+	var request request
+	if err = json.Unmarshal(line, &request); err != nil {
+		daemon.t.Fatalf("error decoding request %q: %s", line, err)
+	}
+	return request
+}
+
+func (daemon *fakeDaemon) respond(request request, result any) {
+	daemon.t.Helper()
+	daemon.send(map[string]any{"jsonrpc": "2.0", "id": request.Id, "result": result})
+}
+
+// `receive` waits for the next state on `Updates`, failing the test
+// if there's none
+func receive(t *testing.T, client *Client) State {
+	t.Helper()
+
+	select {
+	case state, ok := <-client.Updates():
+		if !ok {
+			t.Fatal("updates closed")
+		}
+		return state
+	case <-time.After(5 * time.Second):
+		t.Fatal("no state was received")
+	}
+	return State{}
+}
+
+func TestDial(t *testing.T) {
+	_, dialed := dial(t, true)
+	if dialed.err != nil {
+		t.Fatal(dialed.err)
+	}
+
+	if hello := dialed.client.Hello(); hello.DaemonVersion != "test" || hello.ProtocolVersion != ProtocolVersion {
+		t.Errorf("Hello() = %+v", hello)
+	}
+	if state := receive(t, dialed.client); state.Stable == nil || state.Stable.Message != "greeting" {
+		t.Errorf("first state is %+v, want the one sent on connecting", state)
+	}
+}
+
+func TestDialIncompatible(t *testing.T) {
+	if _, dialed := dial(t, false); dialed.err == nil {
+		t.Error("connected to a daemon with an incompatible protocol")
+	}
+}
+
+func TestResponsesMatchRequests(t *testing.T) {
+	daemon, dialed := dial(t, true)
+	if dialed.err != nil {
+		t.Fatal(dialed.err)
+	}
+
+	type answer struct {
+		result string
+		err    error
+	}
+	answers := map[string]chan answer{
+		"first":   make(chan answer, 1),
+		"second":  make(chan answer, 1),
+		"failing": make(chan answer, 1),
+	}
+	for method := range answers {
+		go func() {
+			var result string
+			err := dialed.client.call(context.Background(), method, nil, &result)
+			answers[method] <- answer{result, err}
+		}()
+	}
+
+	requests := make(map[string]request)
+	for range answers {
+		request := daemon.read()
+		requests[request.Method] = request
+	}
+	// answered out of order, as the daemon may
+	daemon.send(map[string]any{"jsonrpc": "2.0", "id": requests["failing"].Id, "error": Error{Code: CodeFatal, Message: "fatal"}})
+	daemon.respond(requests["second"], "second")
+	daemon.respond(requests["first"], "first")
+
+	for _, method := range []string{"first", "second"} {
+		if answer := <-answers[method]; answer.err != nil || answer.result != method {
+			t.Errorf("'%s' was answered with %q, %v", method, answer.result, answer.err)
+		}
+	}
+	var rpcErr *Error
+	if answer := <-answers["failing"]; !errors.As(answer.err, &rpcErr) || rpcErr.Code != CodeFatal {
+		t.Errorf("'failing' was answered with %v, want an error with code %d", answer.err, CodeFatal)
+	}
+}
+
+func TestUpdatesKeepsLatest(t *testing.T) {
+	daemon, dialed := dial(t, true)
+	if dialed.err != nil {
+		t.Fatal(dialed.err)
+	}
+
+	for _, message := range []string{"first", "second", "latest"} {
+		daemon.send(State{Stable: &Release{Message: message}})
+	}
+	// everything sent before the response has been read by the time it's answered
+	synced := make(chan error, 1)
+	go func() {
+		synced <- dialed.client.call(context.Background(), "sync", nil, nil)
+	}()
+	daemon.respond(daemon.read(), nil)
+	if err := <-synced; err != nil {
+		t.Fatal(err)
+	}
+
+	if state := receive(t, dialed.client); state.Stable == nil || state.Stable.Message != "latest" {
+		t.Errorf("received %+v, want only the latest state", state.Stable)
+	}
+	select {
+	case state := <-dialed.client.Updates():
+		t.Errorf("received %+v after the latest state", state.Stable)
+	default:
+	}
+}
+
+func TestErrAfterDaemonCloses(t *testing.T) {
+	daemon, dialed := dial(t, true)
+	if dialed.err != nil {
+		t.Fatal(dialed.err)
+	}
+	if err := dialed.client.Err(); err != nil {
+		t.Fatalf("Err() = %v whilst connected", err)
+	}
+
+	daemon.conn.Close()
+	// closed once the client has noticed
+	for range dialed.client.Updates() {
+	}
+
+	err := dialed.client.Err()
+	if err == nil || errors.Is(err, ErrClosed) {
+		t.Errorf("Err() = %v, want why the connection closed", err)
+	}
+	if callErr := dialed.client.call(context.Background(), "state", nil, nil); callErr == nil {
+		t.Error("request succeeded after the daemon closed the connection")
+	}
+}
+
+func TestErrAfterClose(t *testing.T) {
+	_, dialed := dial(t, true)
+	if dialed.err != nil {
+		t.Fatal(dialed.err)
+	}
+
+	dialed.client.Close()
+	if err := dialed.client.Err(); !errors.Is(err, ErrClosed) {
+		t.Errorf("Err() = %v, want %v", err, ErrClosed)
+	}
+}
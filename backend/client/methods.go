@@ -0,0 +1,307 @@
+package client
+
+import (
+	"context"
+	"encoding/json/jsontext"
+	"encoding/json/v2"
+	"fmt"
+	"maps"
+)
+
+// Methods of a release run as operations, one at a time per release,
+// and are answered once theirs has finished. An error with the code
+// `CodeProcessFailed` means that the operation itself failed, in
+// which case the release's state describes why. `Start` runs any of
+// them without waiting.
+
+type releaseParams struct {
+	Release string `json:"release"`
+}
+
+type enabledParams struct {
+	releaseParams
+	Enabled bool `json:"enabled"`
+}
+
+// `State` returns the daemon's state as of now
+func (client *Client) State(ctx context.Context) (*State, error) {
+	var state State
+	if err := client.call(ctx, "state", nil, &state); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+func (client *Client) CheckForUpdates(ctx context.Context, release string) error {
+	return client.call(ctx, "release.check_for_updates", releaseParams{release}, nil)
+}
+
+// `Install` installs the release or, if it's installed, any update
+// found when last checking for updates
+func (client *Client) Install(ctx context.Context, release string) error {
+	return client.call(ctx, "release.install", releaseParams{release}, nil)
+}
+
+type UninstallOptions struct {
+	// Move to the trash instead of deleting
+	Trash bool `json:"trash"`
+	// Only report what would be removed
+	DryRun bool `json:"dry_run"`
+	// Also remove data left behind in these scopes: "bd", "modules",
+	// "user_data", "cache" and "state"
+	Purge []string `json:"purge"`
+}
+
+// `Uninstall` uninstalls the release, returning what was removed
+func (client *Client) Uninstall(ctx context.Context, release string, options UninstallOptions) ([]Removal, error) {
+	var removals []Removal
+	err := client.call(ctx, "release.uninstall", struct {
+		releaseParams
+		UninstallOptions
+	}{releaseParams{release}, options}, &removals)
+	return removals, err
+}
+
+// `Move` moves the release's installation into `path`
+func (client *Client) Move(ctx context.Context, release string, path string) error {
+	return client.call(ctx, "release.move", struct {
+		releaseParams
+		Path string `json:"path"`
+	}{releaseParams{release}, path}, nil)
+}
+
+// `Cancel` cancels the release's running operation, if any
+func (client *Client) Cancel(ctx context.Context, release string) error {
+	return client.call(ctx, "release.cancel", releaseParams{release}, nil)
+}
+
+// `ApplyBd` injects the client mod if it's enabled, or restores
+// Discord's own index.js if not. `force` overwrites index.js even if
+// something else has modified it.
+func (client *Client) ApplyBd(ctx context.Context, release string, force bool) error {
+	return client.call(ctx, "release.bd_apply", struct {
+		releaseParams
+		Force bool `json:"force"`
+	}{releaseParams{release}, force}, nil)
+}
+
+func (client *Client) SetBdEnabled(ctx context.Context, release string, enabled bool) error {
+	return client.call(ctx, "release.bd_enabled", enabledParams{releaseParams{release}, enabled}, nil)
+}
+
+// `SetBdChannel` sets the release channel of the client mod, either
+// "stable" or "canary"
+func (client *Client) SetBdChannel(ctx context.Context, release string, channel string) error {
+	return client.call(ctx, "release.bd_channel", struct {
+		releaseParams
+		Channel string `json:"channel"`
+	}{releaseParams{release}, channel}, nil)
+}
+
+// `BdChangelog` describes the installed and latest releases of the
+// client mod, along with each release since the installed one
+func (client *Client) BdChangelog(ctx context.Context, release string) (*BdChangelog, error) {
+	var changelog BdChangelog
+	if err := client.call(ctx, "release.bd_changelog", releaseParams{release}, &changelog); err != nil {
+		return nil, err
+	}
+	return &changelog, nil
+}
+
+// `PinBd` pins the client mod to the release tagged `tag`
+func (client *Client) PinBd(ctx context.Context, release string, tag string) error {
+	return client.call(ctx, "release.bd_pin", struct {
+		releaseParams
+		Tag string `json:"tag"`
+	}{releaseParams{release}, tag}, nil)
+}
+
+func (client *Client) UnpinBd(ctx context.Context, release string) error {
+	return client.call(ctx, "release.bd_unpin", releaseParams{release}, nil)
+}
+
+// `SetInjector` sets which client mod is injected, e.g.
+// "betterdiscord" or "vencord"
+func (client *Client) SetInjector(ctx context.Context, release string, injector string) error {
+	return client.call(ctx, "release.injector", struct {
+		releaseParams
+		Injector string `json:"injector"`
+	}{releaseParams{release}, injector}, nil)
+}
+
+func (client *Client) SetOpenAsar(ctx context.Context, release string, enabled bool) error {
+	return client.call(ctx, "release.open_asar", enabledParams{releaseParams{release}, enabled}, nil)
+}
+
+func (client *Client) SetAutostart(ctx context.Context, release string, enabled bool) error {
+	return client.call(ctx, "release.autostart", enabledParams{releaseParams{release}, enabled}, nil)
+}
+
+func (client *Client) SetAutostartMinimized(ctx context.Context, release string, enabled bool) error {
+	return client.call(ctx, "release.autostart_minimized", enabledParams{releaseParams{release}, enabled}, nil)
+}
+
+func (client *Client) SetCommandLineArguments(ctx context.Context, release string, arguments []string) error {
+	return client.call(ctx, "release.command_line_arguments", struct {
+		releaseParams
+		Arguments []string `json:"arguments"`
+	}{releaseParams{release}, arguments}, nil)
+}
+
+// `SetEnvironment` sets the environment variable `name` Discord is
+// run with, or unsets it if `value` is `nil`
+func (client *Client) SetEnvironment(ctx context.Context, release string, name string, value *string) error {
+	return client.call(ctx, "release.environment", struct {
+		releaseParams
+		Name  string  `json:"name"`
+		Value *string `json:"value,omitzero"`
+	}{releaseParams{release}, name, value}, nil)
+}
+
+// `SetWrapper` sets the command Discord is run through, or unsets it
+// if `command` is empty
+func (client *Client) SetWrapper(ctx context.Context, release string, command []string) error {
+	return client.call(ctx, "release.wrapper", struct {
+		releaseParams
+		Command []string `json:"command"`
+	}{releaseParams{release}, command}, nil)
+}
+
+// `Inspect` checks that the release's installation is intact, along
+// with any asar archives at `paths`, whose entries are also listed
+func (client *Client) Inspect(ctx context.Context, release string, paths ...string) (*Inspection, error) {
+	var inspection Inspection
+	if err := client.call(ctx, "release.inspect", struct {
+		releaseParams
+		Paths []string `json:"paths"`
+	}{releaseParams{release}, paths}, &inspection); err != nil {
+		return nil, err
+	}
+	return &inspection, nil
+}
+
+// `Start` starts the release method `kind` (e.g. "install") with
+// `params`, which may be `nil`, returning its operation without
+// waiting for it to finish
+func (client *Client) Start(ctx context.Context, release string, kind string, params any) (*Operation, error) {
+	merged := map[string]jsontext.Value{}
+	if params != nil {
+		buffer, err := json.Marshal(params)
+		if err != nil {
+			return nil, fmt.Errorf("error encoding parameters of '%s': %w", kind, err)
+		}
+		if err = json.Unmarshal(buffer, &merged); err != nil {
+			return nil, fmt.Errorf("parameters of '%s' must be an object: %w", kind, err)
+		}
+	}
+	id, err := json.Marshal(release)
+	if err != nil {
+		return nil, err
+	}
+	maps.Copy(merged, map[string]jsontext.Value{"release": id, "detach": jsontext.Value("true")})
+
+	var operation Operation
+	if err = client.call(ctx, "release."+kind, merged, &operation); err != nil {
+		return nil, err
+	}
+	return &operation, nil
+}
+
+// `Operations` returns the release's operations, or every release's
+// if `release` is empty, whether queued, running or finished
+func (client *Client) Operations(ctx context.Context, release string) ([]Operation, error) {
+	var operations []Operation
+	err := client.call(ctx, "operation.list", releaseParams{release}, &operations)
+	return operations, err
+}
+
+type operationParams struct {
+	Id uint64 `json:"id"`
+}
+
+// `Wait` waits for the operation `id` to finish, returning it as it
+// finished
+func (client *Client) Wait(ctx context.Context, id uint64) (*Operation, error) {
+	var operation Operation
+	if err := client.call(ctx, "operation.wait", operationParams{id}, &operation); err != nil {
+		return nil, err
+	}
+	return &operation, nil
+}
+
+func (client *Client) CancelOperation(ctx context.Context, id uint64) error {
+	return client.call(ctx, "operation.cancel", operationParams{id}, nil)
+}
+
+// Options left `nil` are left unchanged
+type ConfigurationUpdate struct {
+	AutomaticallyCheckForUpdates *bool   `json:"automatically_check_for_updates,omitzero"`
+	NotifyOnUpdateAvailable      *bool   `json:"notify_on_update_available,omitzero"`
+	AutomaticallyInstallUpdates  *bool   `json:"automatically_install_updates,omitzero"`
+	DefaultInstallPath           *string `json:"default_install_path,omitzero"`
+	GithubToken                  *string `json:"github_token,omitzero"`
+	MaxBroadcastRate             *int    `json:"max_broadcast_rate,omitzero"`
+}
+
+func (client *Client) SetConfiguration(ctx context.Context, update ConfigurationUpdate) error {
+	return client.call(ctx, "config.set", update, nil)
+}
+
+func (client *Client) Addons(ctx context.Context) ([]*Addon, error) {
+	var addons []*Addon
+	err := client.call(ctx, "addon.list", nil, &addons)
+	return addons, err
+}
+
+// `InstallAddon` installs a "plugin" or "theme" from `source`, either
+// a URL or a GitHub repository as `owner/repository`, returning
+// every addon installed
+func (client *Client) InstallAddon(ctx context.Context, kind string, source string) ([]*Addon, error) {
+	var addons []*Addon
+	err := client.call(ctx, "addon.install", struct {
+		Kind   string `json:"kind"`
+		Source string `json:"source"`
+	}{kind, source}, &addons)
+	return addons, err
+}
+
+type addonParams struct {
+	Name string `json:"name"`
+}
+
+// `UpdateAddons` updates the addon `name`, or every addon if empty
+func (client *Client) UpdateAddons(ctx context.Context, name string) ([]*Addon, error) {
+	var addons []*Addon
+	err := client.call(ctx, "addon.update", addonParams{name}, &addons)
+	return addons, err
+}
+
+func (client *Client) RemoveAddon(ctx context.Context, name string) ([]*Addon, error) {
+	var addons []*Addon
+	err := client.call(ctx, "addon.remove", addonParams{name}, &addons)
+	return addons, err
+}
+
+// What a connection is sent, every release or kind being sent
+// until any are subscribed to
+type Subscription struct {
+	Releases []string `json:"releases,omitempty"`
+	// "progress", "status_changed", "error", "release_changed",
+	// "config_changed", "state_changed" or "operation_finished"
+	Kinds []string `json:"kinds,omitempty"`
+}
+
+// `Subscribe` narrows the states sent on `Updates` down to what's
+// subscribed to, adding to any previous subscription, and returns
+// what's now subscribed to
+func (client *Client) Subscribe(ctx context.Context, subscription Subscription) (Subscription, error) {
+	var current Subscription
+	err := client.call(ctx, "subscribe", subscription, &current)
+	return current, err
+}
+
+func (client *Client) Unsubscribe(ctx context.Context, subscription Subscription) (Subscription, error) {
+	var current Subscription
+	err := client.call(ctx, "unsubscribe", subscription, &current)
+	return current, err
+}
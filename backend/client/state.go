@@ -0,0 +1,187 @@
+package client
+
+import (
+	"encoding/json/jsontext"
+	"time"
+)
+
+// The daemon's state as it's broadcast to clients. These mirror the
+// daemon's own types, which are internal to it.
+
+const (
+	Stable = "stable"
+	Ptb    = "ptb"
+	Canary = "canary"
+)
+
+// `Status` is the process a release (or the addons) is running, if any
+type Status string
+
+const (
+	StatusNone        Status = ""
+	StatusInstall     Status = "install"
+	StatusUpdateCheck Status = "update_check"
+	StatusBdInjection Status = "bd_injection"
+	StatusMove        Status = "move"
+	StatusUninstall   Status = "uninstall"
+	StatusOpenAsar    Status = "open_asar"
+	// Something has gone seriously wrong with the release, and no
+	// process can be run until it's dealt with
+	StatusFatal Status = "fatal"
+)
+
+type State struct {
+	Stable        *Release      `json:"stable"`
+	Ptb           *Release      `json:"ptb"`
+	Canary        *Release      `json:"canary"`
+	Configuration Configuration `json:"config"`
+	Addons        *AddonsState  `json:"addons"`
+	// `nil` until the daemon has made a request to the GitHub API
+	GithubRateLimit *GithubRateLimit `json:"github_rate_limit"`
+}
+
+// `Release` returns the state of the release `id`, or `nil` if
+// there's no such release
+func (state *State) Release(id string) *Release {
+	switch id {
+	case Stable:
+		return state.Stable
+	case Ptb:
+		return state.Ptb
+	case Canary:
+		return state.Canary
+	default:
+		return nil
+	}
+}
+
+type Release struct {
+	Status   Status `json:"status"`
+	Message  string `json:"message"`
+	Progress uint8  `json:"progress"` // indeterminate progress when 101
+	Error    string `json:"error"`
+
+	Removals  []Removal        `json:"removals"`  // what the last uninstall removed
+	Reclaimed map[string]int64 `json:"reclaimed"` // total size of `Removals` for each scope
+
+	Inspection *Inspection `json:"inspection"`
+
+	LastReinjection   time.Time `json:"last_reinjection"`
+	ReinjectionReason string    `json:"reinjection_reason"`
+
+	Queue []Operation `json:"queue"` // operations waiting on the active process
+
+	Internal *ReleaseInternal `json:"internal"` // `nil` until the release has been installed
+	Version  string           `json:"version"`
+}
+
+type ReleaseInternal struct {
+	InstallPath        string            `json:"install_path"`
+	LastChecked        time.Time         `json:"last_checked"`
+	LatestVersion      string            `json:"latest_version"`
+	Arguments          []string          `json:"command_line_arguments"`
+	Environment        map[string]string `json:"environment"`
+	Wrapper            []string          `json:"wrapper"`
+	BdEnabled          bool              `json:"bd_enabled"`
+	BdChannel          string            `json:"bd_channel"`
+	BdInstalledRelease *int64            `json:"bd_installed_release"`
+	BdLatestRelease    *int64            `json:"bd_latest_release"`
+	BdInstalled        *BdRelease        `json:"bd_installed"`
+	BdLatest           *BdRelease        `json:"bd_latest"`
+	BdPin              string            `json:"bd_pin"`
+	Injector           string            `json:"injector"`
+	InstalledInjector  string            `json:"installed_injector"`
+	OpenAsar           bool              `json:"open_asar"`
+	Autostart          bool              `json:"autostart"`
+	AutostartMinimized bool              `json:"autostart_minimized"`
+}
+
+// A release of the client mod
+type BdRelease struct {
+	Id          int64     `json:"id"`
+	Tag         string    `json:"tag"`
+	PublishedAt time.Time `json:"published_at"`
+	Notes       string    `json:"notes"`
+	AssetSize   int64     `json:"asset_size"`
+	Prerelease  bool      `json:"prerelease"`
+}
+
+type BdChangelog struct {
+	Installed *BdRelease `json:"installed"` // `nil` if nothing's installed
+	Latest    *BdRelease `json:"latest"`
+	// after the installed release, up to and including the latest
+	Releases []*BdRelease `json:"releases"`
+}
+
+type Removal struct {
+	Scope  string `json:"scope"`
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	Action string `json:"action"` // "delete", "trash" or, for dry runs, "none"
+}
+
+type Inspection struct {
+	Time    time.Time        `json:"time"`
+	Asars   []AsarInspection `json:"asars"`
+	IndexJs string           `json:"index_js"` // "missing", "original", "shim" or "foreign"
+	Error   string           `json:"error"`
+}
+
+type AsarInspection struct {
+	Path    string   `json:"path"`
+	Size    int64    `json:"size"`
+	Files   int      `json:"files"`
+	Error   string   `json:"error"`
+	Entries []string `json:"entries"` // only listed for archives inspected by path
+}
+
+type Configuration struct {
+	AutomaticallyCheckForUpdates bool   `json:"automatically_check_for_updates"`
+	NotifyOnUpdateAvailable      bool   `json:"notify_on_update_available"`
+	AutomaticallyInstallUpdates  bool   `json:"automatically_install_updates"`
+	DefaultInstallPath           string `json:"default_install_path"`
+	// Only whether it's set: "*" if it is
+	GithubToken      string `json:"github_token"`
+	MaxBroadcastRate int    `json:"max_broadcast_rate"`
+	AllowedUids      []int  `json:"allowed_uids"`
+}
+
+type AddonsState struct {
+	Status   Status   `json:"status"`
+	Message  string   `json:"message"`
+	Progress uint8    `json:"progress"`
+	Error    string   `json:"error"`
+	Addons   []*Addon `json:"addons"`
+}
+
+type Addon struct {
+	Name    string    `json:"name"`
+	Kind    string    `json:"kind"`   // "plugin" or "theme"
+	Source  string    `json:"source"` // either a URL or a GitHub repository as `owner/repository`
+	Version string    `json:"version"`
+	File    string    `json:"file"`
+	Sha256  string    `json:"sha256"`
+	Updated time.Time `json:"updated"`
+}
+
+type GithubRateLimit struct {
+	Limit         int       `json:"limit"`
+	Remaining     int       `json:"remaining"`
+	Reset         time.Time `json:"reset"`
+	Authenticated bool      `json:"authenticated"`
+}
+
+// A process run for a release, queued behind any others
+type Operation struct {
+	Id       uint64         `json:"id"`
+	Kind     string         `json:"kind"` // the name of the method that started it, without "release."
+	Release  string         `json:"release"`
+	Params   jsontext.Value `json:"params"`
+	Queued   time.Time      `json:"queued"`
+	Started  time.Time      `json:"started"` // zero until it's started running
+	Finished time.Time      `json:"finished"`
+	Message  string         `json:"message"`
+	Progress uint8          `json:"progress"`
+	Result   jsontext.Value `json:"result"`
+	Error    string         `json:"error"`
+}
@@ -10,11 +10,11 @@ import (
 	"os/signal"
 	"path/filepath"
 	"strings"
-	"sync"
 	"syscall"
 	"time"
 
 	dislaunch "github.com/Fohqul/dislaunch/internal"
+	"github.com/Fohqul/dislaunch/internal/asar"
 	"github.com/gofrs/flock"
 )
 
@@ -25,6 +25,12 @@ func usage() {
 	fmt.Println("\tpath\tGet path of running socket and start one if none is running")
 	fmt.Println("\tstart\tStart the daemon")
 	fmt.Printf("\t\t-p\tPrint \"%s\" when the daemon successfully starts\n", STARTED)
+	fmt.Println("\tlaunch [-u] [-t timeout] <stable|ptb|canary> [-- args]\tLaunch Discord, starting the daemon if none is running")
+	fmt.Println("\t\t-u\tCheck for and install any updates before launching")
+	fmt.Printf("\t\t-t\tGive up updating and launch anyway after the given duration (default %s)\n", dislaunch.DefaultLaunchTimeout)
+	fmt.Println("\t\targs\tExtra arguments to pass to Discord")
+	fmt.Println("\tasar list <archive>\tList the entries of an asar archive")
+	fmt.Println("\tasar extract <archive> <destination>\tExtract an asar archive into a new directory")
 }
 
 func unlock(lockfile *flock.Flock) {
@@ -33,66 +39,158 @@ func unlock(lockfile *flock.Flock) {
 	}
 }
 
-func main() {
-	if len(os.Args) == 1 {
-		usage()
-		return
+// `getPath` returns the path of the running daemon's socket, starting one if none is running
+func getPath(lockfile *flock.Flock) (string, error) {
+	locked, err := lockfile.TryLock()
+	if err != nil && !errors.Is(err, syscall.ENXIO) {
+		return "", fmt.Errorf("error trying to lock at '%s': %w", lockfile.Path(), err)
+	}
+	if !locked {
+		return lockfile.Path(), nil
 	}
 
-	lockfilePath := filepath.Join(dislaunch.GetRuntimeDirectory(), "dislaunch.sock")
-	lockfile := flock.New(lockfilePath)
+	cmd := exec.Command(os.Args[0], "start", "-p")
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Setsid: true,
+	}
 
-	switch os.Args[1] {
-	case "path":
-		locked, err := lockfile.TryLock()
-		if err != nil && !errors.Is(err, syscall.ENXIO) {
-			log.Fatalf("error trying to lock at '%s': %s\n", lockfilePath, err)
-		}
-		if !locked {
-			fmt.Print(lockfilePath)
-			return
-		}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return "", fmt.Errorf("error getting standard output pipe to daemon command: %w", err)
+	}
 
-		cmd := exec.Command(os.Args[0], "start", "-p")
-		cmd.SysProcAttr = &syscall.SysProcAttr{
-			Setsid: true,
+	started := make(chan error, 1)
+	go func() {
+		reader := bufio.NewReader(stdout)
+		for {
+			if line, _, err := reader.ReadLine(); err != nil {
+				started <- fmt.Errorf("error reading from daemon standard output: %w", err)
+				return
+			} else if string(line) == STARTED {
+				started <- nil
+				return
+			}
 		}
+	}()
 
-		stdout, err := cmd.StdoutPipe()
+	unlock(lockfile)
+	if err = cmd.Start(); err != nil {
+		return "", fmt.Errorf("error starting daemon process: %w", err)
+	}
+
+	select {
+	case <-time.After(5 * time.Second):
+		return "", errors.New("daemon timed out")
+	case err := <-started:
 		if err != nil {
-			log.Fatalf("error getting standard output pipe to daemon command: %s\n", err)
+			return "", err
 		}
+		return lockfile.Path(), nil
+	}
+}
 
-		var wg sync.WaitGroup
-		started := make(chan byte)
-		wg.Go(func() {
-			reader := bufio.NewReader(stdout)
-			for {
-				if line, _, err := reader.ReadLine(); err != nil {
-					log.Fatalf("error reading from daemon standard output: %s\n", err)
-				} else if string(line) == STARTED {
-					started <- 0
-					return
-				}
+func launch(lockfile *flock.Flock, arguments []string) {
+	var options dislaunch.LaunchOptions
+	var channel string
+	for i := 0; i < len(arguments); i++ {
+		switch argument := arguments[i]; {
+		case argument == "--":
+			options.Arguments = arguments[i+1:]
+			i = len(arguments)
+		case argument == "-u":
+			options.Update = true
+		case argument == "-t":
+			if i+1 >= len(arguments) {
+				log.Fatalln("timeout required for -t")
 			}
-		})
-
-		timer := time.NewTimer(5 * time.Second)
-		wg.Go(func() {
-			select {
-			case <-timer.C:
-				log.Fatal("daemon timed out")
-			case <-started:
-				fmt.Print(lockfilePath)
-				os.Exit(0)
+			i++
+			timeout, err := time.ParseDuration(arguments[i])
+			if err != nil {
+				log.Fatalf("invalid timeout '%s': %s\n", arguments[i], err)
+			}
+			options.Timeout = timeout
+		case channel == "":
+			channel = argument
+		default:
+			fmt.Fprintf(os.Stderr, "unexpected argument: %s\n", argument)
+			usage()
+			os.Exit(1)
+		}
+	}
+	if channel == "" {
+		fmt.Fprintln(os.Stderr, "release channel required to launch")
+		usage()
+		os.Exit(1)
+	}
+
+	path, err := getPath(lockfile)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	// `Launch` only returns if Discord couldn't be executed
+	log.Fatalln(dislaunch.Launch(path, channel, options))
+}
+
+// `asarCommand` is for debugging, so doesn't need the daemon
+func asarCommand(arguments []string) {
+	if len(arguments) < 2 || (arguments[0] == "extract" && len(arguments) < 3) {
+		usage()
+		os.Exit(1)
+	}
+
+	archive, err := asar.Open(arguments[1])
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer archive.Close()
+
+	switch arguments[0] {
+	case "list":
+		for _, entry := range archive.Entries() {
+			switch {
+			case entry.IsDir():
+				fmt.Printf("%s/\n", entry.Path)
+			case entry.IsLink():
+				fmt.Printf("%s -> %s\n", entry.Path, entry.Link)
+			default:
+				fmt.Printf("%s\t%d\n", entry.Path, entry.Size)
 			}
-		})
+		}
+		if err = archive.Verify(); err != nil {
+			log.Fatalln(err)
+		}
+	case "extract":
+		if err = archive.Extract(arguments[2]); err != nil {
+			log.Fatalf("error extracting '%s': %s\n", arguments[1], err)
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "unknown asar command: %s\n", arguments[0])
+		usage()
+		os.Exit(1)
+	}
+}
+
+func main() {
+	if len(os.Args) == 1 {
+		usage()
+		return
+	}
 
-		unlock(lockfile)
-		if err = cmd.Start(); err != nil {
-			log.Fatalf("error starting daemon process: %s\n", err)
+	lockfilePath := filepath.Join(dislaunch.GetRuntimeDirectory(), "dislaunch.sock")
+	lockfile := flock.New(lockfilePath)
+
+	switch os.Args[1] {
+	case "path":
+		path, err := getPath(lockfile)
+		if err != nil {
+			log.Fatalln(err)
 		}
-		wg.Wait()
+		fmt.Print(path)
+	case "launch":
+		launch(lockfile, os.Args[2:])
+	case "asar":
+		asarCommand(os.Args[2:])
 	case "start":
 		if locked, err := lockfile.TryLock(); err != nil {
 			log.Fatalf("error locking at '%s': %s\nIs another instance of Dislaunch already running?\n", lockfilePath, err)
@@ -7,8 +7,8 @@ require (
 	github.com/gofrs/flock v0.13.0
 	github.com/google/go-github v17.0.0+incompatible
 	github.com/mholt/archives v0.1.5
-	github.com/otiai10/copy v1.14.1
 	github.com/shirou/gopsutil v3.21.11+incompatible
+	golang.org/x/sys v0.41.0
 )
 
 require (
@@ -31,7 +31,6 @@ require (
 	github.com/minio/minlz v1.0.1 // indirect
 	github.com/nfnt/resize v0.0.0-20180221191011-83c6a9932646 // indirect
 	github.com/nwaples/rardecode/v2 v2.2.0 // indirect
-	github.com/otiai10/mint v1.6.3 // indirect
 	github.com/pierrec/lz4/v4 v4.1.22 // indirect
 	github.com/sergeymakinen/go-bmp v1.0.0 // indirect
 	github.com/sergeymakinen/go-ico v1.0.0 // indirect
@@ -44,6 +43,5 @@ require (
 	github.com/yusufpapurcu/wmi v1.2.4 // indirect
 	go4.org v0.0.0-20230225012048-214862532bf5 // indirect
 	golang.org/x/sync v0.17.0 // indirect
-	golang.org/x/sys v0.41.0 // indirect
 	golang.org/x/text v0.29.0 // indirect
 )
@@ -0,0 +1,443 @@
+package dislaunch
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofrs/flock"
+)
+
+// BetterDiscord keeps plugins and themes in its own configuration
+// directory, shared between all releases of Discord, so unlike
+// everything else they're managed globally rather than per release.
+// Each one is recorded with where it came from so that it can be
+// updated alongside the releases.
+
+type addonKind string
+
+const (
+	addonPlugin addonKind = "plugin"
+	addonTheme  addonKind = "theme"
+)
+
+func (kind addonKind) suffix() string {
+	if kind == addonTheme {
+		return ".theme.css"
+	}
+	return ".plugin.js"
+}
+
+func (kind addonKind) directory() (string, error) {
+	config, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("error getting user config directory: %w", err)
+	}
+	return filepath.Join(config, "BetterDiscord", string(kind)+"s"), nil
+}
+
+type addon struct {
+	Name    string    `json:"name"`
+	Kind    addonKind `json:"kind"`
+	Source  string    `json:"source"` // either a URL or a GitHub repository as `owner/repository`
+	Version string    `json:"version"`
+	File    string    `json:"file"`   // name of the file in the kind's directory
+	Sha256  string    `json:"sha256"` // of the file as downloaded, to tell whether an update changed anything
+	Updated time.Time `json:"updated"`
+}
+
+type addonsState struct {
+	Status   status   `json:"status"`
+	Message  string   `json:"message"`
+	Progress uint8    `json:"progress"`
+	Error    string   `json:"error"`
+	Addons   []*addon `json:"addons"`
+}
+
+// Only one addon process runs at once, as with releases
+var addons struct {
+	mu       sync.Mutex
+	status   status
+	message  string
+	progress uint8
+	err      error
+	state    atomic.Value
+}
+
+func getAddonsGobPath() string {
+	return filepath.Join(getHomeXdgDislaunchDirectory("XDG_STATE_HOME", filepath.Join(".local", "state")), "addons.gob")
+}
+
+func getAddons() ([]*addon, error) {
+	path := getAddonsGobPath()
+	lock := flock.New(path)
+	lock.Lock()
+	defer lock.Unlock()
+
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error opening addons: %w", err)
+	}
+	defer file.Close()
+
+	var list []*addon
+	if err = gob.NewDecoder(file).Decode(&list); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("error decoding addons: %w", err)
+	}
+	return list, nil
+}
+
+func setAddons(list []*addon) error {
+	path := getAddonsGobPath()
+	lock := flock.New(path)
+	lock.Lock()
+	defer lock.Unlock()
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("error opening addons: %w", err)
+	}
+	defer file.Close()
+
+	if err = gob.NewEncoder(file).Encode(list); err != nil {
+		return fmt.Errorf("error encoding addons: %w", err)
+	}
+	return nil
+}
+
+func flushAddons(list []*addon, broadcast bool) {
+	state := &addonsState{
+		Status:   addons.status,
+		Message:  addons.message,
+		Progress: addons.progress,
+		Addons:   list,
+	}
+	if addons.err != nil {
+		state.Error = addons.err.Error()
+	}
+	// progress reports don't change the list, so needn't read it again
+	if state.Addons == nil {
+		state.Addons = getAddonsState().Addons
+	}
+
+	addons.state.Store(state)
+	if broadcast {
+		go broadcastBackendState()
+	}
+}
+
+func getAddonsState() *addonsState {
+	if state, ok := addons.state.Load().(*addonsState); ok {
+		return state
+	}
+
+	list, err := getAddons()
+	state := &addonsState{Addons: list}
+	if err != nil {
+		state.Error = err.Error()
+	}
+	return state
+}
+
+// `takeOverAddons` is `takeOver` for addons
+func takeOverAddons() ([]*addon, func(*[]*addon) error, error) {
+	addons.mu.Lock()
+
+	list, err := getAddons()
+	if err != nil {
+		addons.mu.Unlock()
+		return nil, nil, err
+	}
+
+	return list, func(list *[]*addon) error {
+		if err := setAddons(*list); err != nil {
+			addons.err = err
+		}
+		flushAddons(*list, true)
+		err := addons.err
+		addons.status = statusNone
+		addons.message = ""
+		addons.progress = 0
+		addons.err = nil
+		flushAddons(*list, true)
+		addons.mu.Unlock()
+		return err
+	}, nil
+}
+
+// BetterDiscord reads an addon's name and version from the JSDoc
+// style comment at its top, e.g. `/** @name Foo @version 1.0.0 */`
+var addonMetaPattern = regexp.MustCompile(`(?m)^\s*\*?\s*@(name|version)\s+(.+?)\s*$`)
+
+func parseAddonMeta(content []byte) (name string, version string) {
+	end := bytes.Index(content, []byte("*/"))
+	if end == -1 {
+		return "", ""
+	}
+
+	for _, match := range addonMetaPattern.FindAllSubmatch(content[:end], -1) {
+		switch string(match[1]) {
+		case "name":
+			if name == "" {
+				name = string(match[2])
+			}
+		case "version":
+			if version == "" {
+				version = string(match[2])
+			}
+		}
+	}
+	return name, version
+}
+
+var githubRepositoryPattern = regexp.MustCompile(`^(?:https://github\.com/)?([\w.-]+)/([\w.-]+?)(?:\.git)?/?$`)
+
+// `resolveAddon` returns where to download an addon from, along with
+// a version to fall back on if the addon doesn't declare one
+func resolveAddon(ctx context.Context, kind addonKind, source string) (string, string, error) {
+	match := githubRepositoryPattern.FindStringSubmatch(source)
+	if match == nil {
+		parsed, err := url.Parse(source)
+		if err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" {
+			return "", "", fmt.Errorf("addon source is neither a URL nor a GitHub repository: %s", source)
+		}
+		return source, "", nil
+	}
+	owner, repository := match[1], match[2]
+	client := getGithubClient()
+
+	// prefer the latest release, but plenty of addons are just kept in their repository
+	latest, response, err := client.Repositories.GetLatestRelease(ctx, owner, repository)
+	if err != nil && (response == nil || response.StatusCode != http.StatusNotFound) {
+		return "", "", fmt.Errorf("error getting latest release of '%s/%s': %w", owner, repository, err)
+	}
+	if err == nil {
+		for _, asset := range latest.Assets {
+			if strings.HasSuffix(asset.GetName(), kind.suffix()) {
+				return asset.GetBrowserDownloadURL(), latest.GetTagName(), nil
+			}
+		}
+	}
+
+	_, contents, _, err := client.Repositories.GetContents(ctx, owner, repository, "", nil)
+	if err != nil {
+		return "", "", fmt.Errorf("error getting contents of '%s/%s': %w", owner, repository, err)
+	}
+	for _, content := range contents {
+		if content.GetType() == "file" && strings.HasSuffix(content.GetName(), kind.suffix()) {
+			// the abbreviated blob SHA stands in for a version
+			version := content.GetSHA()
+			if version == "" {
+				return "", "", fmt.Errorf("'%s' in '%s/%s' has no SHA to version it by", content.GetName(), owner, repository)
+			}
+			return content.GetDownloadURL(), version[:min(len(version), 7)], nil
+		}
+	}
+
+	return "", "", fmt.Errorf("'%s/%s' has no %s", owner, repository, kind.suffix())
+}
+
+// `fetchAddon` downloads the addon at `source` into its kind's
+// directory, updating `existing` if given
+func fetchAddon(ctx context.Context, kind addonKind, source string, existing *addon) (*addon, error) {
+	addons.message = "Resolving " + source
+	flushAddons(nil, true)
+
+	downloadUrl, fallbackVersion, err := resolveAddon(ctx, kind, source)
+	if err != nil {
+		return nil, err
+	}
+
+	addons.message = "Downloading " + downloadUrl
+	flushAddons(nil, true)
+
+	var buffer bytes.Buffer
+	if err = download(ctx, downloadUrl, &buffer, func(progress uint8) {
+		addons.progress = progress
+		flushAddons(nil, true)
+	}); err != nil {
+		return nil, err
+	}
+	content := buffer.Bytes()
+
+	hash := sha256.Sum256(content)
+	sum := hex.EncodeToString(hash[:])
+	if existing != nil && existing.Sha256 == sum {
+		return existing, nil
+	}
+
+	name, version := parseAddonMeta(content)
+	if version == "" {
+		version = fallbackVersion
+	}
+
+	file := path.Base(downloadUrl)
+	if unescaped, err := url.PathUnescape(file); err == nil {
+		file = unescaped
+	}
+	if existing != nil {
+		file = existing.File
+	} else if !strings.HasSuffix(file, kind.suffix()) {
+		if name == "" {
+			return nil, fmt.Errorf("cannot name addon from '%s', which neither declares a name nor ends with %s", downloadUrl, kind.suffix())
+		}
+		file = name + kind.suffix()
+	}
+	if name == "" {
+		name = strings.TrimSuffix(file, kind.suffix())
+	}
+	if file != filepath.Base(file) || strings.HasPrefix(file, ".") {
+		return nil, fmt.Errorf("invalid addon file name: %s", file)
+	}
+
+	directory, err := kind.directory()
+	if err != nil {
+		return nil, err
+	}
+	if err = os.MkdirAll(directory, 0755); err != nil {
+		return nil, fmt.Errorf("error creating '%s': %w", directory, err)
+	}
+
+	// BetterDiscord reloads addons as soon as they change, so it
+	// mustn't see one partially written
+	if err = writeFileAtomically(filepath.Join(directory, file), content, 0644); err != nil {
+		return nil, fmt.Errorf("error writing addon to '%s': %w", directory, err)
+	}
+
+	return &addon{
+		Name:    name,
+		Kind:    kind,
+		Source:  source,
+		Version: version,
+		File:    file,
+		Sha256:  sum,
+		Updated: time.Now(),
+	}, nil
+}
+
+func findAddon(list []*addon, name string) int {
+	for i, addon := range list {
+		if addon.Name == name || addon.File == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func installAddon(kind addonKind, source string) (result error) {
+	list, reset, err := takeOverAddons()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		result = reset(&list)
+	}()
+
+	addons.status = statusInstall
+	addons.progress = 101
+
+	installed, err := fetchAddon(context.Background(), kind, source, nil)
+	if err != nil {
+		addons.err = fmt.Errorf("error installing %s from '%s': %w", kind, source, err)
+		return
+	}
+
+	// installing an addon again replaces its record
+	if i := findAddon(list, installed.File); i != -1 && list[i].Kind == kind {
+		list[i] = installed
+		return
+	}
+	list = append(list, installed)
+	return
+}
+
+// `updateAddons` updates the addon called `name`, or every addon if
+// `name` is empty
+func updateAddons(name string) (result error) {
+	list, reset, err := takeOverAddons()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		result = reset(&list)
+	}()
+
+	addons.status = statusUpdateCheck
+	addons.progress = 101
+
+	var errs []error
+	found := false
+	for i, existing := range list {
+		if name != "" && existing.Name != name && existing.File != name {
+			continue
+		}
+		found = true
+
+		updated, err := fetchAddon(context.Background(), existing.Kind, existing.Source, existing)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("error updating %s '%s': %w", existing.Kind, existing.Name, err))
+			continue
+		}
+		list[i] = updated
+	}
+
+	if name != "" && !found {
+		errs = append(errs, fmt.Errorf("no addon named '%s'", name))
+	}
+	addons.err = errors.Join(errs...)
+	return
+}
+
+func removeAddon(name string) (result error) {
+	list, reset, err := takeOverAddons()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		result = reset(&list)
+	}()
+
+	i := findAddon(list, name)
+	if i == -1 {
+		addons.err = fmt.Errorf("no addon named '%s'", name)
+		return
+	}
+
+	directory, err := list[i].Kind.directory()
+	if err != nil {
+		addons.err = err
+		return
+	}
+
+	addons.status = statusUninstall
+	addons.progress = 101
+	addons.message = "Removing " + list[i].Name
+	flushAddons(list, true)
+
+	path := filepath.Join(directory, list[i].File)
+	if err = os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		addons.err = fmt.Errorf("error removing '%s': %w", path, err)
+		return
+	}
+
+	list = append(list[:i], list[i+1:]...)
+	return
+}
@@ -0,0 +1,319 @@
+// Package asar reads Electron's asar archives, which Discord uses for
+// `app.asar` and its modules' `core.asar`, and which client mods are
+// distributed as.
+//
+// An asar archive begins with a header describing its files as JSON,
+// wrapped in Chromium's pickle format, followed by the contents of
+// its files one after another. Files too large or otherwise unfit to
+// be packed are instead "unpacked" into a directory beside the
+// archive named after it with `.unpacked` appended.
+package asar
+
+import (
+	"encoding/binary"
+	"encoding/json/v2"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Headers any larger than this are assumed to be corrupt rather than read into memory
+const maxHeaderSize = 64 * 1024 * 1024
+
+type Entry struct {
+	// Slash-separated path within the archive, without a leading slash
+	Path       string            `json:"-"`
+	Files      map[string]*Entry `json:"files,omitempty"`
+	Offset     string            `json:"offset,omitempty"` // a string, as it may exceed what JavaScript can represent as a number
+	Size       int64             `json:"size,omitempty"`
+	Unpacked   bool              `json:"unpacked,omitempty"`
+	Executable bool              `json:"executable,omitempty"`
+	Link       string            `json:"link,omitempty"`
+}
+
+func (entry *Entry) IsDir() bool {
+	return entry.Files != nil
+}
+
+func (entry *Entry) IsLink() bool {
+	return entry.Link != ""
+}
+
+type Archive struct {
+	path   string
+	file   *os.File
+	size   int64
+	base   int64 // offset of the first file's contents
+	header *Entry
+}
+
+func readUint32(file io.Reader) (uint32, error) {
+	var value uint32
+	err := binary.Read(file, binary.LittleEndian, &value)
+	return value, err
+}
+
+// `Open` opens the archive at `name` and parses its header
+func Open(name string) (*Archive, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	archive, err := parse(name, file)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("error parsing asar '%s': %w", name, err)
+	}
+	return archive, nil
+}
+
+func parse(name string, file *os.File) (*Archive, error) {
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	// A pickle containing a single uint32 (the header's size), and
+	// then the header itself: a pickle containing a string
+	sizePickleSize, err := readUint32(file)
+	if err != nil {
+		return nil, fmt.Errorf("error reading header: %w", err)
+	}
+	if sizePickleSize != 4 {
+		return nil, fmt.Errorf("not an asar: header size is %d bytes long instead of 4", sizePickleSize)
+	}
+	headerPickleSize, err := readUint32(file)
+	if err != nil {
+		return nil, fmt.Errorf("error reading header: %w", err)
+	}
+	if headerPickleSize > maxHeaderSize || int64(headerPickleSize)+8 > stat.Size() {
+		return nil, fmt.Errorf("header size %d is impossible for a file of %d bytes", headerPickleSize, stat.Size())
+	}
+
+	pickle := make([]byte, headerPickleSize)
+	if _, err = io.ReadFull(file, pickle); err != nil {
+		return nil, fmt.Errorf("error reading header: %w", err)
+	}
+	if len(pickle) < 8 {
+		return nil, errors.New("header is truncated")
+	}
+	length := binary.LittleEndian.Uint32(pickle[4:8])
+	if int64(length) > int64(len(pickle)-8) {
+		return nil, fmt.Errorf("header string of %d bytes overruns its pickle of %d", length, len(pickle))
+	}
+
+	header := new(Entry)
+	if err = json.Unmarshal(pickle[8:8+length], header); err != nil {
+		return nil, fmt.Errorf("error decoding header: %w", err)
+	}
+	if !header.IsDir() {
+		return nil, errors.New("header has no files")
+	}
+	if err = setPaths(header, ""); err != nil {
+		return nil, err
+	}
+
+	return &Archive{
+		path:   name,
+		file:   file,
+		size:   stat.Size(),
+		base:   8 + int64(headerPickleSize),
+		header: header,
+	}, nil
+}
+
+// `setPaths` sets the path of every entry, rejecting names which
+// aren't a single component, as those of unpacked files are joined
+// onto the `.unpacked` directory and could otherwise lead outside it
+func setPaths(entry *Entry, name string) error {
+	entry.Path = name
+	for child, childEntry := range entry.Files {
+		if child == "" || child == "." || child == ".." || strings.Contains(child, "/") {
+			return fmt.Errorf("'%s' contains invalid name '%s'", name, child)
+		}
+		if childEntry == nil {
+			return fmt.Errorf("'%s' has no entry", path.Join(name, child))
+		}
+		if err := setPaths(childEntry, path.Join(name, child)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (archive *Archive) Close() error {
+	return archive.file.Close()
+}
+
+// `Entries` returns every entry in the archive, sorted by path
+func (archive *Archive) Entries() []*Entry {
+	var entries []*Entry
+	var walk func(entry *Entry)
+	walk = func(entry *Entry) {
+		for _, child := range entry.Files {
+			entries = append(entries, child)
+			if child.IsDir() {
+				walk(child)
+			}
+		}
+	}
+	walk(archive.header)
+
+	slices.SortFunc(entries, func(a *Entry, b *Entry) int {
+		return strings.Compare(a.Path, b.Path)
+	})
+	return entries
+}
+
+// `Find` returns the entry at `name`, without following links
+func (archive *Archive) Find(name string) (*Entry, error) {
+	entry := archive.header
+	for component := range strings.SplitSeq(path.Clean("/" + name)[1:], "/") {
+		if component == "" {
+			continue
+		}
+		if !entry.IsDir() {
+			return nil, fmt.Errorf("'%s' is not a directory", entry.Path)
+		}
+		child, exists := entry.Files[component]
+		if !exists {
+			return nil, fmt.Errorf("'%s' does not exist in '%s': %w", name, archive.path, os.ErrNotExist)
+		}
+		entry = child
+	}
+	return entry, nil
+}
+
+// `Open` returns a reader for the contents of the file `entry`
+func (archive *Archive) Open(entry *Entry) (io.ReadCloser, error) {
+	if entry.IsDir() || entry.IsLink() {
+		return nil, fmt.Errorf("'%s' is not a regular file", entry.Path)
+	}
+
+	if entry.Unpacked {
+		return os.Open(filepath.Join(archive.path+".unpacked", filepath.FromSlash(entry.Path)))
+	}
+
+	offset, err := strconv.ParseInt(entry.Offset, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("'%s' has invalid offset '%s': %w", entry.Path, entry.Offset, err)
+	}
+	return io.NopCloser(io.NewSectionReader(archive.file, archive.base+offset, entry.Size)), nil
+}
+
+// `Verify` checks that the contents of every packed file lie within
+// the archive and that every unpacked file exists, which is enough
+// to catch truncated downloads and archives that aren't asars at all
+func (archive *Archive) Verify() error {
+	for _, entry := range archive.Entries() {
+		if entry.IsDir() || entry.IsLink() {
+			continue
+		}
+
+		if entry.Unpacked {
+			path := filepath.Join(archive.path+".unpacked", filepath.FromSlash(entry.Path))
+			stat, err := os.Stat(path)
+			if err != nil {
+				return fmt.Errorf("unpacked file '%s' is missing: %w", entry.Path, err)
+			}
+			if stat.Size() != entry.Size {
+				return fmt.Errorf("unpacked file '%s' has size %d instead of %d", entry.Path, stat.Size(), entry.Size)
+			}
+			continue
+		}
+
+		offset, err := strconv.ParseInt(entry.Offset, 10, 64)
+		if err != nil {
+			return fmt.Errorf("'%s' has invalid offset '%s': %w", entry.Path, entry.Offset, err)
+		}
+		if offset < 0 || entry.Size < 0 || archive.base+offset+entry.Size > archive.size {
+			return fmt.Errorf("'%s' lies outside the archive", entry.Path)
+		}
+	}
+	return nil
+}
+
+// `Extract` extracts every entry in the archive into `destination`,
+// which mustn't already exist. Everything is created through an
+// `os.Root`, so nothing can be written outside of `destination`, even
+// through a link.
+func (archive *Archive) Extract(destination string) error {
+	if err := os.Mkdir(destination, 0755); err != nil {
+		return err
+	}
+	root, err := os.OpenRoot(destination)
+	if err != nil {
+		return err
+	}
+	defer root.Close()
+
+	links := make(map[string]bool)
+	for _, entry := range archive.Entries() {
+		// `setPaths` has already rejected any name that isn't a single component
+		path := filepath.FromSlash(entry.Path)
+		if !filepath.IsLocal(path) {
+			return fmt.Errorf("'%s' would be extracted outside of '%s'", entry.Path, destination)
+		}
+		for parent := filepath.Dir(path); parent != "."; parent = filepath.Dir(parent) {
+			if links[parent] {
+				return fmt.Errorf("'%s' would be extracted through the link '%s'", entry.Path, filepath.ToSlash(parent))
+			}
+		}
+
+		switch {
+		case entry.IsDir():
+			if err := root.Mkdir(path, 0755); err != nil {
+				return err
+			}
+		case entry.IsLink():
+			// links are relative to the root of the archive rather than to themselves
+			link := filepath.FromSlash(entry.Link)
+			if !filepath.IsLocal(link) {
+				return fmt.Errorf("'%s' links to '%s', which is outside of the archive", entry.Path, entry.Link)
+			}
+			relative, err := filepath.Rel(filepath.Dir(path), link)
+			if err != nil {
+				return err
+			}
+			if err = root.Symlink(relative, path); err != nil {
+				return err
+			}
+			links[path] = true
+		default:
+			if err := archive.extractFile(root, entry, path); err != nil {
+				return fmt.Errorf("error extracting '%s': %w", entry.Path, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (archive *Archive) extractFile(root *os.Root, entry *Entry, path string) error {
+	source, err := archive.Open(entry)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	var perm os.FileMode = 0644
+	if entry.Executable {
+		perm = 0755
+	}
+	file, err := root.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, perm)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if _, err = io.Copy(file, source); err != nil {
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,205 @@
+package asar
+
+import (
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// `writeFile` writes `contents` to a file in a temporary directory
+func writeFile(t *testing.T, contents []byte) string {
+	t.Helper()
+
+	name := filepath.Join(t.TempDir(), "test.asar")
+	if err := os.WriteFile(name, contents, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+// `writeArchive` writes an archive with the header `header` and the
+// contents `contents` into a temporary directory
+func writeArchive(t *testing.T, header string, contents string) string {
+	t.Helper()
+
+	// the header string is padded to a multiple of 4 bytes, as pickles are
+	padded := len(header) + (4-len(header)%4)%4
+	buffer := binary.LittleEndian.AppendUint32(nil, 4)
+	buffer = binary.LittleEndian.AppendUint32(buffer, uint32(8+padded))
+	buffer = binary.LittleEndian.AppendUint32(buffer, uint32(4+padded))
+	buffer = binary.LittleEndian.AppendUint32(buffer, uint32(len(header)))
+	buffer = append(buffer, header...)
+	buffer = append(buffer, make([]byte, padded-len(header))...)
+	buffer = append(buffer, contents...)
+
+	return writeFile(t, buffer)
+}
+
+func extract(t *testing.T, header string, contents string) (string, error) {
+	t.Helper()
+
+	archive, err := Open(writeArchive(t, header, contents))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer archive.Close()
+
+	destination := filepath.Join(t.TempDir(), "extracted")
+	return destination, archive.Extract(destination)
+}
+
+func TestExtract(t *testing.T) {
+	destination, err := extract(t, `{"files":{
+		"index.js":{"offset":"0","size":5},
+		"lib":{"files":{"main.js":{"offset":"5","size":4,"executable":true},"link.js":{"link":"index.js"}}}
+	}}`, "hellomain")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, expected := range map[string]string{
+		"index.js":    "hello",
+		"lib/main.js": "main",
+		"lib/link.js": "hello",
+	} {
+		contents, err := os.ReadFile(filepath.Join(destination, filepath.FromSlash(name)))
+		if err != nil {
+			t.Errorf("error reading '%s': %s", name, err)
+			continue
+		}
+		if string(contents) != expected {
+			t.Errorf("'%s' contains %q, want %q", name, contents, expected)
+		}
+	}
+
+	// links are relative to the root of the archive, but on disk they're relative to themselves
+	link, err := os.Readlink(filepath.Join(destination, "lib", "link.js"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if link != filepath.Join("..", "index.js") {
+		t.Errorf("'lib/link.js' links to '%s', want '../index.js'", link)
+	}
+}
+
+func TestExtractRejectsEscapes(t *testing.T) {
+	outside := t.TempDir()
+
+	for name, header := range map[string]string{
+		"absolute link": `{"files":{"a":{"link":"` + outside + `"}}}`,
+		"relative link": `{"files":{"a":{"link":"../.."}}}`,
+	} {
+		if _, err := extract(t, header, "evil"); err == nil {
+			t.Errorf("%s: extracted without error", name)
+		}
+	}
+
+	entries, err := os.ReadDir(outside)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("%d entries were written outside of the destination", len(entries))
+	}
+}
+
+func TestOpenRejectsCorruptHeaders(t *testing.T) {
+	pickle := func(values ...uint32) []byte {
+		var buffer []byte
+		for _, value := range values {
+			buffer = binary.LittleEndian.AppendUint32(buffer, value)
+		}
+		return buffer
+	}
+
+	for name, contents := range map[string][]byte{
+		"empty":              nil,
+		"truncated":          pickle(4),
+		"not an asar":        pickle(8, 16),
+		"oversized header":   pickle(4, 0xfffffff0),
+		"header beyond file": append(pickle(4, 64, 60, 56), `{"files":{}}`...),
+		"overrunning string": append(pickle(4, 16, 12, 1024), `{"files":{}}`...),
+	} {
+		if archive, err := Open(writeFile(t, contents)); err == nil {
+			archive.Close()
+			t.Errorf("%s: opened without error", name)
+		}
+	}
+
+	for name, header := range map[string]string{
+		"no files":     `{"offset":"0","size":4}`,
+		"invalid JSON": `{"files":`,
+		"parent name":  `{"files":{"..":{"files":{"passwd":{"unpacked":true,"size":4}}}}}`,
+		"current name": `{"files":{".":{"offset":"0","size":4}}}`,
+		"empty name":   `{"files":{"":{"offset":"0","size":4}}}`,
+		"nested name":  `{"files":{"../escaped":{"offset":"0","size":4}}}`,
+		"null entry":   `{"files":{"a":null}}`,
+	} {
+		if archive, err := Open(writeArchive(t, header, "evil")); err == nil {
+			archive.Close()
+			t.Errorf("%s: opened without error", name)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	for name, test := range map[string]struct {
+		header string
+		valid  bool
+	}{
+		"intact":           {`{"files":{"a":{"offset":"0","size":4},"b":{"files":{"c":{"offset":"4","size":0}}}}}`, true},
+		"offset beyond":    {`{"files":{"a":{"offset":"2","size":4}}}`, false},
+		"size beyond":      {`{"files":{"a":{"offset":"0","size":5}}}`, false},
+		"negative":         {`{"files":{"a":{"offset":"-1","size":4}}}`, false},
+		"invalid offset":   {`{"files":{"a":{"offset":"zero","size":4}}}`, false},
+		"missing unpacked": {`{"files":{"a":{"unpacked":true,"size":4}}}`, false},
+	} {
+		archive, err := Open(writeArchive(t, test.header, "data"))
+		if err != nil {
+			t.Errorf("%s: error opening: %s", name, err)
+			continue
+		}
+		if err = archive.Verify(); (err == nil) != test.valid {
+			t.Errorf("%s: Verify() = %v", name, err)
+		}
+		archive.Close()
+	}
+}
+
+func TestOpenUnpacked(t *testing.T) {
+	name := writeArchive(t, `{"files":{"dir":{"files":{"a":{"unpacked":true,"size":8}}}}}`, "")
+	if err := os.MkdirAll(filepath.Join(name+".unpacked", "dir"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(name+".unpacked", "dir", "a"), []byte("unpacked"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	archive, err := Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer archive.Close()
+	if err = archive.Verify(); err != nil {
+		t.Error(err)
+	}
+
+	entry, err := archive.Find("dir/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader, err := archive.Open(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	contents, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(contents) != "unpacked" {
+		t.Errorf("'dir/a' contains %q, want %q", contents, "unpacked")
+	}
+}
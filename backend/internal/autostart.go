@@ -0,0 +1,92 @@
+package dislaunch
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func (release *release) autostartEntryPath() string {
+	return filepath.Join(getHomeXdgDirectory("XDG_CONFIG_HOME", ".config"), "autostart", release.desktopEntryFileName)
+}
+
+// Rather than being generated from scratch, the autostart entry
+// is derived from the desktop entry written by `install` so that
+// it keeps Discord's own name, icon, etc. Only the `Exec` line is
+// replaced, which points at the launcher just like the desktop
+// entry does, so Discord is always updated before it's started.
+func (release *release) writeAutostartEntry(internal *releaseInternal) error {
+	path := release.autostartEntryPath()
+
+	if !internal.Autostart {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("error removing autostart entry '%s': %w", path, err)
+		}
+		return nil
+	}
+
+	desktopEntry, err := os.ReadFile(release.desktopEntryPath())
+	if err != nil {
+		return fmt.Errorf("error reading desktop entry for release '%s': %w", release, err)
+	}
+
+	exec, err := release.launcherExec()
+	if err != nil {
+		return err
+	}
+	if internal.AutostartMinimized {
+		exec += " --start-minimized"
+	}
+
+	lines := strings.Split(string(desktopEntry), "\n")
+	for i, line := range lines {
+		if strings.HasPrefix(line, "Exec=") {
+			lines[i] = exec
+		}
+	}
+
+	if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("error creating autostart directory '%s': %w", filepath.Dir(path), err)
+	}
+
+	if err = os.WriteFile(path, []byte(strings.Join(lines, "\n")), 0644); err != nil {
+		return fmt.Errorf("error writing autostart entry '%s': %w", path, err)
+	}
+	return nil
+}
+
+func (release *release) setAutostart(autostart bool) (result error) {
+	internal, reset, err := release.takeOver()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		result = reset()
+	}()
+
+	previous := internal.Autostart
+	internal.Autostart = autostart
+	if err := release.writeAutostartEntry(internal); err != nil {
+		internal.Autostart = previous
+		release.err = err
+	}
+	return
+}
+
+func (release *release) setAutostartMinimized(autostartMinimized bool) (result error) {
+	internal, reset, err := release.takeOver()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		result = reset()
+	}()
+
+	internal.AutostartMinimized = autostartMinimized
+	if err := release.writeAutostartEntry(internal); err != nil {
+		release.err = err
+	}
+	return
+}
@@ -17,19 +17,42 @@ type Configuration struct {
 	NotifyOnUpdateAvailable      bool   `json:"notify_on_update_available"`
 	AutomaticallyInstallUpdates  bool   `json:"automatically_install_updates"`
 	DefaultInstallPath           string `json:"default_install_path"`
+	// Overridden by the environment; see `getGithubToken`
+	GithubToken string `json:"github_token"`
+	// The most times per second the state is broadcast to clients,
+	// or `defaultMaxBroadcastRate` if zero
+	MaxBroadcastRate int `json:"max_broadcast_rate"`
+	// UIDs besides the user's own allowed to connect to the socket,
+	// which is then accessible to the user's group, so they must be
+	// in it. Deliberately only set by editing the configuration file.
+	AllowedUids []int `json:"allowed_uids"`
 }
 
-func openConfigurationFile(flag int) (*os.File, func()) {
+const configurationFileName = "io.github.Fohqul.Dislaunch.json"
+
+func getConfigurationPath() string {
 	configurationDirectory, err := os.UserConfigDir()
 	if err != nil {
 		log.Fatalf("error getting configuration directory: %s\n", err)
 	}
+	return filepath.Join(configurationDirectory, configurationFileName)
+}
 
-	path := filepath.Join(configurationDirectory, "io.github.Fohqul.Dislaunch.json")
-	lock := flock.New(path)
-	if err = lock.Lock(); err != nil {
+// `lockConfigurationFile` locks a file beside the configuration file
+// rather than the file itself, which is replaced whenever it's written
+func lockConfigurationFile(path string) func() {
+	lock := flock.New(path + ".lock")
+	if err := lock.Lock(); err != nil {
 		log.Fatalf("error locking configuration file: %s\n", err)
 	}
+	return func() {
+		lock.Unlock()
+	}
+}
+
+func openConfigurationFile(flag int) (*os.File, func()) {
+	path := getConfigurationPath()
+	unlock := lockConfigurationFile(path)
 
 	configurationFile, err := os.OpenFile(path, os.O_CREATE|flag, 0600)
 	if err != nil {
@@ -37,7 +60,7 @@ func openConfigurationFile(flag int) (*os.File, func()) {
 	}
 	return configurationFile, func() {
 		configurationFile.Close()
-		lock.Unlock()
+		unlock()
 	}
 }
 
@@ -78,13 +101,57 @@ func getConfiguration() Configuration {
 	return configuration
 }
 
+// The state is broadcast far more often than the configuration
+// changes, so broadcasts use a copy of it cached by
+// `getCachedConfiguration` rather than reading the file each time.
+// The watcher reloads it whenever the file changes, so that edits
+// by hand are picked up too.
+var cachedConfiguration struct {
+	mu            sync.Mutex
+	configuration *Configuration
+}
+
+func getCachedConfiguration() Configuration {
+	cachedConfiguration.mu.Lock()
+	defer cachedConfiguration.mu.Unlock()
+
+	if cachedConfiguration.configuration == nil {
+		configuration := getConfiguration()
+		cachedConfiguration.configuration = &configuration
+	}
+	return *cachedConfiguration.configuration
+}
+
+// `reloadConfiguration` rereads the configuration file into the cache
+func reloadConfiguration() {
+	configuration := getConfiguration()
+	cachedConfiguration.mu.Lock()
+	cachedConfiguration.configuration = &configuration
+	cachedConfiguration.mu.Unlock()
+
+	go broadcastBackendState()
+}
+
 func setConfiguration(configuration Configuration) error {
-	configurationFile, close := openConfigurationFile(os.O_WRONLY)
-	defer close()
-	if err := json.MarshalWrite(configurationFile, configuration); err != nil {
+	path := getConfigurationPath()
+	unlock := lockConfigurationFile(path)
+	defer unlock()
+
+	buffer, err := json.Marshal(configuration)
+	if err != nil {
 		fmt.Fprintf(os.Stderr, "error encoding configuration: %s\n", err)
 		return err // todo should this be fatal?
 	}
+	// written whole rather than over the old contents, which would
+	// leave the end of anything longer (such as a token) behind
+	if err = writeFileAtomically(path, buffer, 0600); err != nil {
+		fmt.Fprintf(os.Stderr, "error writing configuration: %s\n", err)
+		return err
+	}
+
+	cachedConfiguration.mu.Lock()
+	cachedConfiguration.configuration = &configuration
+	cachedConfiguration.mu.Unlock()
 
 	go broadcastBackendState()
 
@@ -102,37 +169,34 @@ func setConfiguration(configuration Configuration) error {
 // Therefore, a mutex is used to prevent this.
 var mu sync.Mutex
 
-func setAutomaticallyCheckForUpdates(setting bool) {
+func setAutomaticallyCheckForUpdates(setting bool) error {
 	mu.Lock()
 	defer mu.Unlock()
 
 	configuration := getConfiguration()
 	configuration.AutomaticallyCheckForUpdates = setting
-	setConfiguration(configuration)
+	return setConfiguration(configuration)
 }
 
-func setNotifyOnUpdateAvailable(setting bool) {
+func setNotifyOnUpdateAvailable(setting bool) error {
 	mu.Lock()
 	defer mu.Unlock()
 
 	configuration := getConfiguration()
 	configuration.NotifyOnUpdateAvailable = setting
-	setConfiguration(configuration)
+	return setConfiguration(configuration)
 }
 
-func setAutomaticallyInstallUpdates(setting bool) {
+func setAutomaticallyInstallUpdates(setting bool) error {
 	mu.Lock()
 	defer mu.Unlock()
 
 	configuration := getConfiguration()
 	configuration.AutomaticallyInstallUpdates = setting
-	setConfiguration(configuration)
+	return setConfiguration(configuration)
 }
 
-func setDefaultInstallPath(path string) error {
-	mu.Lock()
-	defer mu.Unlock()
-
+func validateInstallPath(path string) error {
 	stat, err := os.Stat(path)
 	if err != nil {
 		return err
@@ -140,13 +204,40 @@ func setDefaultInstallPath(path string) error {
 	if !stat.IsDir() {
 		return fmt.Errorf("cannot install to non-directory: %s", path)
 	}
+	return assertWritePermissions(path)
+}
 
-	if err = assertWritePermissions(path); err != nil {
+func setDefaultInstallPath(path string) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if err := validateInstallPath(path); err != nil {
 		return err
 	}
 
 	configuration := getConfiguration()
 	configuration.DefaultInstallPath = path
-	setConfiguration(configuration)
-	return nil
+	return setConfiguration(configuration)
+}
+
+func setGithubToken(token string) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	configuration := getConfiguration()
+	configuration.GithubToken = token
+	return setConfiguration(configuration)
+}
+
+func setMaxBroadcastRate(rate int) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if rate < 0 {
+		return fmt.Errorf("invalid maximum broadcast rate: %d", rate)
+	}
+
+	configuration := getConfiguration()
+	configuration.MaxBroadcastRate = rate
+	return setConfiguration(configuration)
 }
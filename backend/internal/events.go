@@ -0,0 +1,304 @@
+package dislaunch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json/jsontext"
+	"encoding/json/v2"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+)
+
+// Rather than the whole state on every change, connections may ask
+// for a stream of events instead, each carrying only what changed
+// along with a sequence number. Sequence numbers count the events
+// sent to each connection, so that those it isn't subscribed to
+// don't leave gaps. They're sent as JSON-RPC
+// notifications of the method "event".
+//
+// Events carry the new values of whatever changed rather than how
+// to change them, so applying one that's already reflected in a
+// snapshot is harmless. A client that misses events (i.e. sees a
+// gap in sequence numbers) or is otherwise unsure of its state can
+// ask for a snapshot, which is sent in the stream like any other
+// event so that it's never overtaken by those before it.
+
+type eventKind string
+
+const (
+	eventSnapshot          eventKind = "snapshot"
+	eventProgress          eventKind = "progress"
+	eventStatusChanged     eventKind = "status_changed"
+	eventError             eventKind = "error"
+	eventReleaseChanged    eventKind = "release_changed" // anything else about a release, e.g. its version
+	eventConfigChanged     eventKind = "config_changed"
+	eventStateChanged      eventKind = "state_changed" // anything else, e.g. addons
+	eventOperationFinished eventKind = "operation_finished"
+)
+
+type event struct {
+	Seq     uint64                    `json:"seq"`
+	Kind    eventKind                 `json:"kind"`
+	Release string                    `json:"release,omitempty"`
+	Changes map[string]jsontext.Value `json:"changes,omitempty"` // a value of `null` means the field was cleared
+	State   *backendState             `json:"state,omitempty"`   // for snapshots
+	// For `operation_finished`, the operation as it finished
+	Operation *operation `json:"operation,omitempty"`
+}
+
+type eventNotification struct {
+	JsonRpc string `json:"jsonrpc"`
+	Method  string `json:"method"`
+	Params  event  `json:"params"`
+}
+
+var events struct {
+	mu sync.Mutex
+	// the state as of the last events, decoded as far as the fields
+	// of each release and the configuration, which are compared
+	last map[string]map[string]jsontext.Value
+	// events to send with the next broadcast, rather than straight
+	// away, so that they follow the changes leading up to them
+	pending []event
+}
+
+var releaseIds = []string{"stable", "ptb", "canary"}
+
+// `flattenState` decodes `state` into the fields of each of its
+// members, which are compared to find what changed
+func flattenState(state backendState) (map[string]map[string]jsontext.Value, error) {
+	buffer, err := json.Marshal(state, json.OmitZeroStructFields(true))
+	if err != nil {
+		return nil, err
+	}
+
+	var members map[string]jsontext.Value
+	if err = json.Unmarshal(buffer, &members); err != nil {
+		return nil, err
+	}
+
+	// anything else is compared as a whole, under ""
+	flattened := map[string]map[string]jsontext.Value{"": {}}
+	for name, value := range members {
+		if !slices.Contains(releaseIds, name) && name != "config" {
+			flattened[""][name] = value
+			continue
+		}
+
+		var fields map[string]jsontext.Value
+		if err = json.Unmarshal(value, &fields); err != nil {
+			return nil, err
+		}
+		flattened[name] = fields
+	}
+	return flattened, nil
+}
+
+// `diffFields` returns the fields of `current` that differ from `previous`
+func diffFields(previous map[string]jsontext.Value, current map[string]jsontext.Value) map[string]jsontext.Value {
+	changes := make(map[string]jsontext.Value)
+	for name, value := range current {
+		if !bytes.Equal(previous[name], value) {
+			changes[name] = value
+		}
+	}
+	for name := range previous {
+		if _, exists := current[name]; !exists {
+			changes[name] = jsontext.Value("null")
+		}
+	}
+	return changes
+}
+
+// `take` moves the fields named `names` out of `changes`, if any
+func take(changes map[string]jsontext.Value, names ...string) map[string]jsontext.Value {
+	taken := make(map[string]jsontext.Value)
+	for _, name := range names {
+		if value, exists := changes[name]; exists {
+			taken[name] = value
+			delete(changes, name)
+		}
+	}
+	return taken
+}
+
+// `diffState` returns the events describing how `current` differs
+// from `previous`, without sequence numbers
+func diffState(previous map[string]map[string]jsontext.Value, current map[string]map[string]jsontext.Value) []event {
+	var diff []event
+	add := func(kind eventKind, release string, changes map[string]jsontext.Value) {
+		if len(changes) != 0 {
+			diff = append(diff, event{Kind: kind, Release: release, Changes: changes})
+		}
+	}
+
+	for _, id := range releaseIds {
+		changes := diffFields(previous[id], current[id])
+		add(eventStatusChanged, id, take(changes, "status"))
+		add(eventProgress, id, take(changes, "message", "progress"))
+		// an error being cleared is just part of its release being reset, not an error
+		if value, exists := changes["error"]; exists && string(value) != "null" {
+			add(eventError, id, take(changes, "error"))
+		}
+		add(eventReleaseChanged, id, changes)
+	}
+
+	add(eventConfigChanged, "", diffFields(previous["config"], current["config"]))
+	add(eventStateChanged, "", diffFields(previous[""], current[""]))
+	return diff
+}
+
+// `queueEvent` sends `event` with the next broadcast
+func queueEvent(event event) {
+	events.mu.Lock()
+	events.pending = append(events.pending, event)
+	events.mu.Unlock()
+	broadcastBackendState()
+}
+
+// `encodeEvent` numbers `event` for `entry` and encodes it for
+// sending. `container.mu` must be held.
+func encodeEvent(entry *connectionEntry, event event) ([]byte, error) {
+	entry.seq++
+	event.Seq = entry.seq
+	buffer, err := json.Marshal(eventNotification{JsonRpc: "2.0", Method: "event", Params: event}, json.OmitZeroStructFields(true))
+	if err != nil {
+		return nil, err
+	}
+	return append(buffer, '\n'), nil
+}
+
+// `sendEvents` sends whatever changed since the last events, and
+// any queued events, to every connection streaming events
+func sendEvents(state backendState) {
+	events.mu.Lock()
+	defer events.mu.Unlock()
+
+	streaming := false
+	container.mu.Lock()
+	for _, entry := range container.connections {
+		streaming = streaming || entry.events
+	}
+	container.mu.Unlock()
+	if !streaming {
+		// there's nothing to compare with once a connection starts
+		// streaming, as it starts with a snapshot anyway
+		events.last = nil
+		events.pending = nil
+		return
+	}
+
+	current, err := flattenState(state)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error flattening backend state: %s\n", err)
+		return
+	}
+	diff := diffState(events.last, current)
+	events.last = current
+	diff = append(diff, events.pending...)
+	events.pending = nil
+
+	container.mu.Lock()
+	defer container.mu.Unlock()
+	for _, entry := range container.connections {
+		if !entry.events {
+			continue
+		}
+		for _, event := range diff {
+			if !entry.subscription.wants(event) {
+				continue
+			}
+			message, err := encodeEvent(entry, event)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error marshalling %s event to JSON: %s\n", event.Kind, err)
+				continue
+			}
+			entry.send(message, messageEvent)
+		}
+	}
+}
+
+// `streamEvents` switches the connection making the request to
+// events, starting with a snapshot, and returns the snapshot's
+// sequence number
+func streamEvents(ctx context.Context, enabled bool) (uint64, error) {
+	entry := getRequester(ctx)
+	if entry == nil {
+		return 0, fmt.Errorf("not a connection")
+	}
+
+	events.mu.Lock()
+	defer events.mu.Unlock()
+	container.mu.Lock()
+	defer container.mu.Unlock()
+
+	if container.connections[entry.conn] != entry {
+		return 0, context.Canceled
+	}
+	entry.events = enabled
+	if !enabled {
+		return entry.seq, nil
+	}
+	return sendSnapshot(entry)
+}
+
+// `sendSnapshot` sends the whole state to `entry` as an event. Both
+// locks must be held.
+func sendSnapshot(entry *connectionEntry) (uint64, error) {
+	state := getBackendState()
+	if events.last == nil {
+		// nothing has been sent yet to compare with
+		last, err := flattenState(state)
+		if err != nil {
+			return 0, err
+		}
+		events.last = last
+	}
+
+	state = entry.subscription.filter(state)
+	message, err := encodeEvent(entry, event{Kind: eventSnapshot, State: &state})
+	if err != nil {
+		return 0, err
+	}
+	// never dropped, as it's how the client recovers from events being dropped
+	entry.send(message, messageResponse)
+	return entry.seq, nil
+}
+
+// `resendState` sends the whole state to `entry` even if it's what
+// it was last sent, as a snapshot if it's streaming events. Both
+// locks must be held.
+func resendState(entry *connectionEntry) {
+	if !entry.events {
+		entry.last = nil
+		go broadcastBackendState()
+		return
+	}
+	if _, err := sendSnapshot(entry); err != nil {
+		fmt.Fprintf(os.Stderr, "error sending snapshot: %s\n", err)
+	}
+}
+
+// `resync` sends a snapshot to the connection making the request,
+// which must be streaming events
+func resync(ctx context.Context) (uint64, error) {
+	entry := getRequester(ctx)
+	if entry == nil {
+		return 0, fmt.Errorf("not a connection")
+	}
+
+	events.mu.Lock()
+	defer events.mu.Unlock()
+	container.mu.Lock()
+	defer container.mu.Unlock()
+
+	if container.connections[entry.conn] != entry {
+		return 0, context.Canceled
+	}
+	if !entry.events {
+		return 0, fmt.Errorf("not streaming events")
+	}
+	return sendSnapshot(entry)
+}
@@ -0,0 +1,222 @@
+package dislaunch
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// Unauthenticated requests to the GitHub API are limited to 60 an
+// hour per IP address, which is quickly exhausted by a few releases
+// checking for client mod updates from behind a shared NAT. So, all
+// requests go through `githubTransport`, which authenticates them if
+// a token is configured, makes them conditional on what's already
+// been fetched (which GitHub doesn't count against the limit) and
+// stops making them at all once the limit's been reached.
+
+// The environment variables checked for a token, in order, before
+// falling back to the configuration
+var githubTokenVariables = []string{"DISLAUNCH_GITHUB_TOKEN", "GITHUB_TOKEN"}
+
+func getGithubToken() string {
+	for _, variable := range githubTokenVariables {
+		if token := os.Getenv(variable); token != "" {
+			return token
+		}
+	}
+	return getConfiguration().GithubToken
+}
+
+type githubRateLimit struct {
+	Limit     int       `json:"limit"`
+	Remaining int       `json:"remaining"`
+	Reset     time.Time `json:"reset"`
+	// whether the limit is that of an authenticated user rather than the IP address
+	Authenticated bool `json:"authenticated"`
+}
+
+type githubRateLimitError struct {
+	reset time.Time
+}
+
+func (err *githubRateLimitError) Error() string {
+	return fmt.Sprintf("GitHub API rate limit exceeded, try again after %s", err.reset.Local().Format(time.Kitchen))
+}
+
+// Responses are cached one per URL, up to this many URLs, beyond
+// which the least recently used is evicted
+const maxGithubCacheEntries = 256
+
+type githubCacheEntry struct {
+	// a hash of the token the response was fetched with, as what a
+	// request may see depends on who's making it
+	credential [sha256.Size]byte
+	etag       string
+	header     http.Header
+	body       []byte
+	used       time.Time
+}
+
+type githubTransport struct {
+	mu        sync.Mutex
+	cache     map[string]*githubCacheEntry
+	rateLimit *githubRateLimit
+}
+
+var transport = &githubTransport{
+	cache: make(map[string]*githubCacheEntry),
+}
+
+// `getGithubClient` returns a client for the GitHub API. It's cheap
+// to call, so it should be called for each process in case the
+// token has changed.
+func getGithubClient() *github.Client {
+	return github.NewClient(&http.Client{Transport: transport})
+}
+
+// `getGithubRateLimit` returns the rate limit as of the most recent
+// request, or `nil` if no request has been made yet
+func getGithubRateLimit() *githubRateLimit {
+	transport.mu.Lock()
+	defer transport.mu.Unlock()
+
+	if transport.rateLimit == nil {
+		return nil
+	}
+	rateLimit := *transport.rateLimit
+	return &rateLimit
+}
+
+func (transport *githubTransport) updateRateLimit(header http.Header, authenticated bool) {
+	limit, err := strconv.Atoi(header.Get("X-RateLimit-Limit"))
+	if err != nil {
+		return
+	}
+	remaining, err := strconv.Atoi(header.Get("X-RateLimit-Remaining"))
+	if err != nil {
+		return
+	}
+	reset, err := strconv.ParseInt(header.Get("X-RateLimit-Reset"), 10, 64)
+	if err != nil {
+		return
+	}
+
+	transport.mu.Lock()
+	transport.rateLimit = &githubRateLimit{
+		Limit:         limit,
+		Remaining:     remaining,
+		Reset:         time.Unix(reset, 0),
+		Authenticated: authenticated,
+	}
+	transport.mu.Unlock()
+
+	go broadcastBackendState()
+}
+
+func (transport *githubTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	token := getGithubToken()
+	authenticated := token != ""
+
+	transport.mu.Lock()
+	rateLimit := transport.rateLimit
+	// a new token comes with its own limit
+	if rateLimit != nil && rateLimit.Remaining == 0 && rateLimit.Authenticated == authenticated && time.Now().Before(rateLimit.Reset) {
+		transport.mu.Unlock()
+		return nil, &githubRateLimitError{rateLimit.Reset}
+	}
+
+	key := request.URL.String()
+	credential := sha256.Sum256([]byte(token))
+	cached := transport.cache[key]
+	if cached != nil && cached.credential != credential {
+		cached = nil
+	}
+	if cached != nil {
+		cached.used = time.Now()
+	}
+	transport.mu.Unlock()
+
+	// `RoundTrip` mustn't modify the request it's given
+	request = request.Clone(request.Context())
+	if authenticated {
+		request.Header.Set("Authorization", "token "+token)
+	}
+	if cached != nil && request.Method == http.MethodGet {
+		request.Header.Set("If-None-Match", cached.etag)
+	}
+
+	response, err := http.DefaultTransport.RoundTrip(request)
+	if err != nil {
+		return nil, err
+	}
+	transport.updateRateLimit(response.Header, authenticated)
+
+	switch {
+	case response.StatusCode == http.StatusNotModified && cached != nil:
+		response.Body.Close()
+
+		header := cached.header.Clone()
+		for _, name := range []string{"X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset"} {
+			header.Set(name, response.Header.Get(name))
+		}
+		return &http.Response{
+			Status:        "200 OK",
+			StatusCode:    http.StatusOK,
+			Proto:         response.Proto,
+			ProtoMajor:    response.ProtoMajor,
+			ProtoMinor:    response.ProtoMinor,
+			Header:        header,
+			Body:          io.NopCloser(bytes.NewReader(cached.body)),
+			ContentLength: int64(len(cached.body)),
+			Request:       request,
+		}, nil
+	case (response.StatusCode == http.StatusForbidden || response.StatusCode == http.StatusTooManyRequests) && response.Header.Get("X-RateLimit-Remaining") == "0":
+		response.Body.Close()
+		reset, _ := strconv.ParseInt(response.Header.Get("X-RateLimit-Reset"), 10, 64)
+		return nil, &githubRateLimitError{time.Unix(reset, 0)}
+	case response.StatusCode == http.StatusOK && request.Method == http.MethodGet && response.Header.Get("ETag") != "":
+		body, err := io.ReadAll(response.Body)
+		response.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		transport.store(key, &githubCacheEntry{
+			credential: credential,
+			etag:       response.Header.Get("ETag"),
+			header:     response.Header.Clone(),
+			body:       body,
+			used:       time.Now(),
+		})
+
+		response.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	return response, nil
+}
+
+// `store` caches `entry` for `key`, replacing whatever was cached
+// for it and evicting the least recently used entry if need be
+func (transport *githubTransport) store(key string, entry *githubCacheEntry) {
+	transport.mu.Lock()
+	defer transport.mu.Unlock()
+
+	if _, exists := transport.cache[key]; !exists && len(transport.cache) >= maxGithubCacheEntries {
+		var oldest string
+		for cachedKey, cached := range transport.cache {
+			if oldest == "" || cached.used.Before(transport.cache[oldest].used) {
+				oldest = cachedKey
+			}
+		}
+		delete(transport.cache, oldest)
+	}
+	transport.cache[key] = entry
+}
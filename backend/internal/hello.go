@@ -0,0 +1,98 @@
+package dislaunch
+
+import (
+	"context"
+	"encoding/json/v2"
+	"fmt"
+	"log"
+	"os"
+	"runtime/debug"
+)
+
+// Every connection is first sent a "hello" notification describing
+// the daemon, followed by the whole state, so that clients needn't
+// ask for it. Clients may in turn say hello with their own version,
+// which is answered with whether the daemon can serve them.
+
+// `Version` is the daemon's version, which may be set when building
+// with `-ldflags "-X github.com/Fohqul/dislaunch/internal.Version=..."`.
+// Otherwise, it's the version of the module as built.
+var Version string
+
+// What the daemon supports beyond the original text commands, for
+// clients to check rather than comparing versions
+var capabilities = []string{"json_rpc", "operations", "queue", "events", "subscriptions"}
+
+type hello struct {
+	DaemonVersion   string   `json:"daemon_version"`
+	ProtocolVersion int      `json:"protocol_version"`
+	Capabilities    []string `json:"capabilities"`
+}
+
+type clientHelloParams struct {
+	Client          string `json:"client"`
+	Version         string `json:"version"`
+	ProtocolVersion int    `json:"protocol_version"`
+}
+
+type helloResult struct {
+	hello
+	// false if the client needs a newer protocol than the daemon's
+	Compatible bool `json:"compatible"`
+}
+
+func getDaemonVersion() string {
+	if Version != "" {
+		return Version
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		return info.Main.Version
+	}
+	return "unknown"
+}
+
+func getHello() hello {
+	return hello{
+		DaemonVersion:   getDaemonVersion(),
+		ProtocolVersion: protocolVersion,
+		Capabilities:    capabilities,
+	}
+}
+
+// `greet` sends `entry` the hello notification and then the state
+func greet(entry *connectionEntry) {
+	buffer, err := json.Marshal(struct {
+		JsonRpc string `json:"jsonrpc"`
+		Method  string `json:"method"`
+		Params  hello  `json:"params"`
+	}{"2.0", "hello", getHello()})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error marshalling hello to JSON: %s\n", err)
+		return
+	}
+	entry.send(append(buffer, '\n'), messageResponse)
+
+	state, err := json.Marshal(getBackendState(), json.OmitZeroStructFields(true))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error marshalling backend state to JSON: %s\n", err)
+		return
+	}
+	state = append(state, '\n')
+
+	container.mu.Lock()
+	entry.last = state
+	container.mu.Unlock()
+	entry.send(state, messageState)
+}
+
+// `clientHello` records the client's version, answering with the
+// daemon's and whether the two are compatible
+func clientHello(ctx context.Context, params clientHelloParams) (any, error) {
+	if entry := getRequester(ctx); entry != nil {
+		log.Printf("Connection %p is %s %s (protocol version %d)\n", entry.conn, params.Client, params.Version, params.ProtocolVersion)
+	}
+	return helloResult{
+		hello:      getHello(),
+		Compatible: params.ProtocolVersion <= protocolVersion,
+	}, nil
+}
@@ -0,0 +1,353 @@
+package dislaunch
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// An injector injects a client mod into Discord by placing its files
+// in the `discord_desktop_core` module and replacing the module's
+// `index.js` with a shim which loads the mod before Discord's core.
+type injector interface {
+	// Identifies the injector in the socket protocol and internal data
+	String() string
+	// Human-readable name for messages
+	name() string
+	fetchLatest(ctx context.Context, client *github.Client, channel bdChannel) (*github.RepositoryRelease, error)
+	fetchTag(ctx context.Context, client *github.Client, tag string) (*github.RepositoryRelease, error)
+	fetchId(ctx context.Context, client *github.Client, id int64) (*github.RepositoryRelease, error)
+	// `list` returns a page of releases, newest first
+	list(ctx context.Context, client *github.Client, page int) ([]*github.RepositoryRelease, *github.Response, error)
+	// The asset of `release` which `install` downloads, if any
+	getAsset(release *github.RepositoryRelease) *github.ReleaseAsset
+	// `install` downloads the given release of the mod into `directory`
+	install(ctx context.Context, client *github.Client, directory string, releaseId int64, progress func(progress uint8)) error
+	shim() string
+	remove(directory string) error
+	// Whether the mod's files are present in `directory`
+	isInstalled(directory string) bool
+	// The paths of the mod's files within `directory`
+	paths(directory string) []string
+}
+
+// The contents of `discord_desktop_core/index.js` without any client
+// mod. Discord's own is backed up before it's first replaced, so this
+// is only assumed when there's no backup, e.g. from before there were.
+const vanillaShim = "module.exports = require('./core.asar');"
+
+const indexJsBackupName = "index.js.orig"
+
+// Whether `content` is the shim of any injector, so that switching
+// between them doesn't mistake another's shim for Discord's original
+func isShim(content []byte) bool {
+	for _, injector := range injectors {
+		if bytes.Equal(bytes.TrimSpace(content), []byte(injector.shim())) {
+			return true
+		}
+	}
+	return false
+}
+
+func isVanilla(content []byte) bool {
+	return bytes.Equal(bytes.TrimSpace(content), []byte(vanillaShim))
+}
+
+type foreignIndexJsError struct {
+	path string
+}
+
+func (err *foreignIndexJsError) Error() string {
+	return fmt.Sprintf("'%s' has been modified by something other than Discord or Dislaunch - run bd_apply --force to overwrite it", err.path)
+}
+
+// `readIndexJs` returns the contents of `index.js` and its backup
+// in `directory`, either of which is `nil` if it doesn't exist
+func readIndexJs(directory string) ([]byte, []byte, error) {
+	indexJs, err := os.ReadFile(filepath.Join(directory, "index.js"))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, nil, fmt.Errorf("error reading index.js: %w", err)
+	}
+	backup, err := os.ReadFile(filepath.Join(directory, indexJsBackupName))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, nil, fmt.Errorf("error reading backup of index.js: %w", err)
+	}
+	return indexJs, backup, nil
+}
+
+// `injectIndexJs` replaces `index.js` in `directory` with `shim`,
+// first backing up Discord's original. If `index.js` has been
+// replaced by anything else since, it's only overwritten if `force`
+// is set, in which case it's taken to be the original instead.
+func injectIndexJs(directory string, shim string, force bool) error {
+	indexJsPath := filepath.Join(directory, "index.js")
+	indexJs, backup, err := readIndexJs(directory)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case bytes.Equal(indexJs, []byte(shim)):
+		return nil
+	// Discord hasn't written it yet, or it's already been backed up
+	case indexJs == nil, isShim(indexJs), backup != nil && bytes.Equal(indexJs, backup):
+	// not backed up yet, or Discord's module updater has rewritten it
+	case backup == nil, isVanilla(indexJs), force:
+		if err = writeFileAtomically(filepath.Join(directory, indexJsBackupName), indexJs, 0644); err != nil {
+			return fmt.Errorf("error backing up '%s': %w", indexJsPath, err)
+		}
+	default:
+		return &foreignIndexJsError{indexJsPath}
+	}
+
+	if err = writeFileAtomically(indexJsPath, []byte(shim), 0644); err != nil {
+		return fmt.Errorf("error writing '%s': %w", indexJsPath, err)
+	}
+	return nil
+}
+
+// `restoreIndexJs` restores Discord's original `index.js` in
+// `directory` byte-for-byte. As with `injectIndexJs`, an `index.js`
+// that's neither a shim nor the original is only overwritten if
+// `force` is set.
+func restoreIndexJs(directory string, force bool) error {
+	indexJsPath := filepath.Join(directory, "index.js")
+	backupPath := filepath.Join(directory, indexJsBackupName)
+	indexJs, backup, err := readIndexJs(directory)
+	if err != nil {
+		return err
+	}
+
+	original := backup
+	if original == nil {
+		original = []byte(vanillaShim)
+	}
+
+	switch {
+	case indexJs == nil && backup == nil:
+		return nil
+	case indexJs != nil && !isShim(indexJs):
+		if backup == nil || bytes.Equal(indexJs, backup) || isVanilla(indexJs) {
+			// already restored, but the backup is outdated or redundant
+			if err = os.Remove(backupPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return fmt.Errorf("error removing '%s': %w", backupPath, err)
+			}
+			return nil
+		}
+		if !force {
+			return &foreignIndexJsError{indexJsPath}
+		}
+	}
+
+	if err = writeFileAtomically(indexJsPath, original, 0644); err != nil {
+		return fmt.Errorf("error restoring '%s': %w", indexJsPath, err)
+	}
+	if err = os.Remove(backupPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("error removing '%s': %w", backupPath, err)
+	}
+	return nil
+}
+
+// Client mods distributed as a single asar in their GitHub releases
+type asarInjector struct {
+	id          string
+	displayName string
+	owner       string
+	repository  string
+	asset       string // name of the release asset to download
+	asar        string // name to save the asset as within `discord_desktop_core`
+}
+
+func (injector *asarInjector) String() string {
+	return injector.id
+}
+
+func (injector *asarInjector) name() string {
+	return injector.displayName
+}
+
+func (injector *asarInjector) fetchLatest(ctx context.Context, client *github.Client, channel bdChannel) (*github.RepositoryRelease, error) {
+	switch channel {
+	case bdStable:
+		release, _, err := client.Repositories.GetLatestRelease(ctx, injector.owner, injector.repository)
+		if err != nil {
+			return nil, fmt.Errorf("error getting latest %s release: %w", injector.displayName, err)
+		}
+		return release, nil
+	case bdCanary:
+		releases, _, err := client.Repositories.ListReleases(ctx, injector.owner, injector.repository, &github.ListOptions{Page: 1, PerPage: 1})
+		if err != nil {
+			return nil, fmt.Errorf("error getting %s releases: %w", injector.displayName, err)
+		}
+		if len(releases) == 0 {
+			return nil, fmt.Errorf("%s has no releases", injector.displayName)
+		}
+		return releases[0], nil
+	default:
+		return nil, fmt.Errorf("invalid %s release channel: %s", injector.displayName, channel)
+	}
+}
+
+func (injector *asarInjector) fetchTag(ctx context.Context, client *github.Client, tag string) (*github.RepositoryRelease, error) {
+	release, _, err := client.Repositories.GetReleaseByTag(ctx, injector.owner, injector.repository, tag)
+	if err != nil {
+		return nil, fmt.Errorf("error getting %s release '%s': %w", injector.displayName, tag, err)
+	}
+	return release, nil
+}
+
+func (injector *asarInjector) fetchId(ctx context.Context, client *github.Client, id int64) (*github.RepositoryRelease, error) {
+	release, _, err := client.Repositories.GetRelease(ctx, injector.owner, injector.repository, id)
+	if err != nil {
+		return nil, fmt.Errorf("error getting %s release: %w", injector.displayName, err)
+	}
+	return release, nil
+}
+
+func (injector *asarInjector) list(ctx context.Context, client *github.Client, page int) ([]*github.RepositoryRelease, *github.Response, error) {
+	releases, response, err := client.Repositories.ListReleases(ctx, injector.owner, injector.repository, &github.ListOptions{Page: page, PerPage: 100})
+	if err != nil {
+		return nil, nil, fmt.Errorf("error getting %s releases: %w", injector.displayName, err)
+	}
+	return releases, response, nil
+}
+
+func (injector *asarInjector) getAsset(release *github.RepositoryRelease) *github.ReleaseAsset {
+	for _, asset := range release.Assets {
+		if asset.GetName() == injector.asset {
+			return &asset
+		}
+	}
+	return nil
+}
+
+func (injector *asarInjector) install(ctx context.Context, client *github.Client, directory string, releaseId int64, progress func(progress uint8)) error {
+	release, err := injector.fetchId(ctx, client, releaseId)
+	if err != nil {
+		return err
+	}
+
+	asset := injector.getAsset(release)
+	if asset == nil {
+		return fmt.Errorf("%s release '%s' has no asset '%s'", injector.displayName, release.GetTagName(), injector.asset)
+	}
+
+	// downloaded alongside and validated before being renamed
+	// over, so that a broken download is never injected
+	asarPath := filepath.Join(directory, injector.asar)
+	downloadPath := asarPath + ".part"
+	asar, err := os.OpenFile(downloadPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("error opening '%s': %w", downloadPath, err)
+	}
+	defer os.Remove(downloadPath) // fails harmlessly once renamed
+	defer asar.Close()
+
+	if err = download(ctx, asset.GetBrowserDownloadURL(), asar, progress); err != nil {
+		return fmt.Errorf("error downloading %s: %w", injector.displayName, err)
+	}
+	if err = asar.Close(); err != nil {
+		return fmt.Errorf("error writing '%s': %w", downloadPath, err)
+	}
+	if err = validateAsar(downloadPath); err != nil {
+		return fmt.Errorf("downloaded %s is invalid: %w", injector.displayName, err)
+	}
+	if err = os.Rename(downloadPath, asarPath); err != nil {
+		return fmt.Errorf("error moving %s into place: %w", injector.displayName, err)
+	}
+	return nil
+}
+
+func (injector *asarInjector) shim() string {
+	return fmt.Sprintf("require(\"./%s\");\nmodule.exports = require(\"./core.asar\");", injector.asar)
+}
+
+func (injector *asarInjector) remove(directory string) error {
+	if err := os.Remove(filepath.Join(directory, injector.asar)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("error deleting %s: %w", injector.displayName, err)
+	}
+	return nil
+}
+
+func (injector *asarInjector) isInstalled(directory string) bool {
+	_, err := os.Stat(filepath.Join(directory, injector.asar))
+	return err == nil
+}
+
+// What's known of a release of a client mod, since its GitHub ID
+// alone means nothing to a user
+type bdRelease struct {
+	Id          int64     `json:"id"`
+	Tag         string    `json:"tag"`
+	PublishedAt time.Time `json:"published_at"`
+	Notes       string    `json:"notes"`
+	AssetSize   int64     `json:"asset_size"`
+	Prerelease  bool      `json:"prerelease"`
+}
+
+// The result of `bd_changelog`, which is only returned to whoever
+// asked for it rather than kept in the state, as the notes of many
+// releases would be broadcast to every client with every change
+type bdChangelog struct {
+	Installed *bdRelease `json:"installed"` // `nil` if nothing's installed
+	Latest    *bdRelease `json:"latest"`
+	// after the installed release, up to and including the latest
+	Releases []*bdRelease `json:"releases"`
+}
+
+func describeBdRelease(injector injector, release *github.RepositoryRelease) *bdRelease {
+	description := &bdRelease{
+		Id:          release.GetID(),
+		Tag:         release.GetTagName(),
+		PublishedAt: release.GetPublishedAt().Time,
+		Notes:       release.GetBody(),
+		Prerelease:  release.GetPrerelease(),
+	}
+	if asset := injector.getAsset(release); asset != nil {
+		description.AssetSize = int64(asset.GetSize())
+	}
+	return description
+}
+
+func (injector *asarInjector) paths(directory string) []string {
+	return []string{filepath.Join(directory, injector.asar)}
+}
+
+var injectors = map[string]injector{
+	"betterdiscord": &asarInjector{
+		id:          "betterdiscord",
+		displayName: "BetterDiscord",
+		owner:       "BetterDiscord",
+		repository:  "BetterDiscord",
+		asset:       "betterdiscord.asar",
+		asar:        "betterdiscord.asar",
+	},
+	"vencord": &asarInjector{
+		id:          "vencord",
+		displayName: "Vencord",
+		owner:       "Vendicated",
+		repository:  "Vencord",
+		asset:       "desktop.asar",
+		asar:        "vencord.asar",
+	},
+}
+
+// BetterDiscord was the only client mod before injectors were
+// introduced, so gobs from then have no injector recorded
+func getInjector(id string) (injector, error) {
+	if id == "" {
+		id = "betterdiscord"
+	}
+
+	injector, ok := injectors[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown injector: %s", id)
+	}
+	return injector, nil
+}
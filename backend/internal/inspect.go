@@ -0,0 +1,141 @@
+package dislaunch
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Fohqul/dislaunch/internal/asar"
+)
+
+// `validateAsar` checks that `path` is an intact asar archive
+func validateAsar(path string) error {
+	archive, err := asar.Open(path)
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+
+	if err = archive.Verify(); err != nil {
+		return fmt.Errorf("asar '%s' is corrupt: %w", path, err)
+	}
+	return nil
+}
+
+type asarInspection struct {
+	Path  string `json:"path"`
+	Size  int64  `json:"size"`
+	Files int    `json:"files"`
+	Error string `json:"error"`
+	// only listed for archives inspected by path
+	Entries []string `json:"entries"`
+}
+
+type indexJsState string
+
+const (
+	indexJsMissing  indexJsState = "missing"
+	indexJsOriginal indexJsState = "original"
+	indexJsShim     indexJsState = "shim"
+	indexJsForeign  indexJsState = "foreign"
+)
+
+// The result of the last `inspect`, to help work out what's wrong
+// with a broken install
+type inspection struct {
+	Time    time.Time        `json:"time"`
+	Asars   []asarInspection `json:"asars"`
+	IndexJs indexJsState     `json:"index_js"`
+	Error   string           `json:"error"`
+}
+
+func inspectAsar(path string, list bool) asarInspection {
+	inspection := asarInspection{Path: path}
+	if stat, err := os.Stat(path); err == nil {
+		inspection.Size = stat.Size()
+	}
+
+	archive, err := asar.Open(path)
+	if err != nil {
+		inspection.Error = err.Error()
+		return inspection
+	}
+	defer archive.Close()
+
+	entries := archive.Entries()
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			inspection.Files++
+		}
+		if list {
+			inspection.Entries = append(inspection.Entries, entry.Path)
+		}
+	}
+	if err = archive.Verify(); err != nil {
+		inspection.Error = err.Error()
+	}
+	return inspection
+}
+
+func getIndexJsState(directory string) (indexJsState, error) {
+	indexJs, backup, err := readIndexJs(directory)
+	switch {
+	case err != nil:
+		return "", err
+	case indexJs == nil:
+		return indexJsMissing, nil
+	case isShim(indexJs):
+		return indexJsShim, nil
+	case isVanilla(indexJs), backup == nil, bytes.Equal(indexJs, backup):
+		return indexJsOriginal, nil
+	default:
+		return indexJsForeign, nil
+	}
+}
+
+// `inspect` checks `app.asar`, `core.asar` and the client mod, along
+// with any archives given by `paths`, whose entries are also listed
+func (release *release) inspect(paths []string) (result error) {
+	internal, reset, err := release.takeOver()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		result = reset()
+	}()
+
+	report := &inspection{Time: time.Now()}
+	defer func() {
+		release.inspection = report
+	}()
+
+	if internal.InstallPath != "" {
+		report.Asars = append(report.Asars, inspectAsar(filepath.Join(internal.InstallPath, release.pathName, "resources", "app.asar"), false))
+	}
+
+	version, err := release.getVersion(internal)
+	if err != nil {
+		report.Error = err.Error()
+	} else if core, err := release.getCoreModulePath(version); err != nil {
+		report.Error = err.Error()
+	} else {
+		report.Asars = append(report.Asars, inspectAsar(filepath.Join(core, "core.asar"), false))
+
+		if injector, err := getInjector(internal.Injector); err == nil && injector.isInstalled(core) {
+			for _, path := range injector.paths(core) {
+				report.Asars = append(report.Asars, inspectAsar(path, false))
+			}
+		}
+
+		if report.IndexJs, err = getIndexJsState(core); err != nil {
+			report.Error = err.Error()
+		}
+	}
+
+	for _, path := range paths {
+		report.Asars = append(report.Asars, inspectAsar(path, true))
+	}
+	return
+}
@@ -15,7 +15,7 @@ func runInterval(configuration Configuration, release *release) {
 		return
 	}
 
-	release.checkForUpdates()
+	release.run("check_for_updates", releaseParams{Release: release.id}, processResult(release.checkForUpdates))
 	state = release.getState()
 	if state.Status == statusFatal || state.Internal == nil || state.Version == state.Internal.LatestVersion {
 		return
@@ -35,7 +35,7 @@ func runInterval(configuration Configuration, release *release) {
 	}
 
 	if configuration.AutomaticallyInstallUpdates {
-		release.install()
+		release.run("install", releaseParams{Release: release.id}, processResult(release.install))
 	}
 }
 
@@ -54,5 +54,7 @@ func startIntervals() {
 			})
 		}
 		wg.Wait() // if any of the goroutines take longer to finish than the interval, stop them accumulating
+
+		updateAddons("")
 	}
 }
@@ -0,0 +1,289 @@
+package dislaunch
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json/jsontext"
+	"encoding/json/v2"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+const DefaultLaunchTimeout = 30 * time.Second
+
+type LaunchOptions struct {
+	// Check for and install updates before launching
+	Update bool
+	// How long to wait on updating before launching anyway
+	Timeout time.Duration
+	// Passed to Discord after the release's own command-line arguments
+	Arguments []string
+}
+
+// Launching runs in a separate process to the daemon, so it can't
+// use `getStable` etc. without reading the gobs itself. It only
+// needs the path name, though.
+func getPathName(id string) (string, error) {
+	switch id {
+	case "stable":
+		return "Discord", nil
+	case "ptb":
+		return "DiscordPTB", nil
+	case "canary":
+		return "DiscordCanary", nil
+	default:
+		return "", fmt.Errorf("unknown release: %s", id)
+	}
+}
+
+type launcher struct {
+	id       string
+	conn     net.Conn
+	reader   *bufio.Reader
+	partial  []byte    // what was read of a line before a read timed out
+	next     uint64    // ID of the next request
+	deadline time.Time // when to give up updating
+}
+
+func (launcher *launcher) release(state *backendState) (*releaseState, error) {
+	var releaseState *releaseState
+	switch launcher.id {
+	case "stable":
+		releaseState = state.Stable
+	case "ptb":
+		releaseState = state.Ptb
+	case "canary":
+		releaseState = state.Canary
+	}
+	if releaseState == nil {
+		return nil, fmt.Errorf("backend state is missing release '%s'", launcher.id)
+	}
+	return releaseState, nil
+}
+
+// `call` makes a request of the daemon and waits for its response,
+// meanwhile printing the release's progress from the broadcasted
+// state
+func (launcher *launcher) call(method string, params any, result any) error {
+	launcher.next++
+	id := jsontext.Value(strconv.FormatUint(launcher.next, 10))
+	request := rpcRequest{JsonRpc: "2.0", Id: id, Method: method}
+	if params != nil {
+		var err error
+		if request.Params, err = json.Marshal(params); err != nil {
+			return fmt.Errorf("error encoding request '%s': %w", method, err)
+		}
+	}
+	buffer, err := json.Marshal(request, json.OmitZeroStructFields(true))
+	if err != nil {
+		return fmt.Errorf("error encoding request '%s': %w", method, err)
+	}
+	if _, err = launcher.conn.Write(append(buffer, '\n')); err != nil {
+		return fmt.Errorf("error writing request '%s' to daemon: %w", method, err)
+	}
+
+	var message string
+	for {
+		line, err := launcher.reader.ReadBytes('\n')
+		line = append(launcher.partial, line...)
+		launcher.partial = nil
+		if err != nil {
+			// the rest of the line may yet be read once the deadline is extended
+			launcher.partial = line
+			return fmt.Errorf("error reading from daemon: %w", err)
+		}
+
+		var response rpcResponse
+		if err = json.Unmarshal(line, &response); err != nil {
+			return fmt.Errorf("error decoding message from daemon: %w", err)
+		}
+
+		// anything that isn't a response is a broadcasted state
+		if response.JsonRpc == "" {
+			var state backendState
+			if err = json.Unmarshal(line, &state); err != nil {
+				return fmt.Errorf("error decoding backend state: %w", err)
+			}
+			if releaseState, err := launcher.release(&state); err == nil && releaseState.Status != statusNone && releaseState.Message != "" && releaseState.Message != message {
+				message = releaseState.Message
+				fmt.Fprintf(os.Stderr, "%s: %s\n", launcher.id, message)
+			}
+			continue
+		}
+
+		if !bytes.Equal(response.Id, id) {
+			continue
+		}
+		if response.Error != nil {
+			return response.Error
+		}
+		if result == nil {
+			return nil
+		}
+		if err = json.Unmarshal(response.Result, result); err != nil {
+			return fmt.Errorf("error decoding result of '%s': %w", method, err)
+		}
+		return nil
+	}
+}
+
+func (launcher *launcher) getState() (*releaseState, error) {
+	var state backendState
+	if err := launcher.call("state", nil, &state); err != nil {
+		return nil, err
+	}
+	return launcher.release(&state)
+}
+
+// `await` runs `command` on the release, waiting for it to finish,
+// and returns the release's state as of then
+func (launcher *launcher) await(command string) (*releaseState, error) {
+	// Started without a deadline, as the daemon answers straight away,
+	// so that the launcher always knows what it started. Otherwise, an
+	// install could be started that it then didn't wait on.
+	if time.Now().After(launcher.deadline) {
+		return nil, os.ErrDeadlineExceeded
+	}
+	if err := launcher.conn.SetReadDeadline(time.Time{}); err != nil {
+		return nil, fmt.Errorf("error clearing read deadline: %w", err)
+	}
+	var started operation
+	err := launcher.call("release."+command, releaseParams{Release: launcher.id, Detach: true}, &started)
+	if deadlineErr := launcher.conn.SetReadDeadline(launcher.deadline); deadlineErr != nil {
+		return nil, fmt.Errorf("error setting read deadline: %w", deadlineErr)
+	}
+	var rpcErr *rpcError
+	if errors.As(err, &rpcErr) && rpcErr.Code == codeFatal {
+		return nil, fmt.Errorf("release '%s' is in a fatal state: %s", launcher.id, rpcErr.Message)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var finished operation
+	err = launcher.call("operation.wait", operationParams{Id: started.Id}, &finished)
+	// Installing extracts over the installed release, so Discord
+	// can't be launched until it has finished
+	if errors.Is(err, os.ErrDeadlineExceeded) && command == "install" {
+		fmt.Fprintf(os.Stderr, "%s: still installing - waiting for it to finish before launching\n", launcher.id)
+		if err = launcher.conn.SetReadDeadline(time.Time{}); err != nil {
+			return nil, fmt.Errorf("error clearing read deadline: %w", err)
+		}
+		err = launcher.call("operation.wait", operationParams{Id: started.Id}, &finished)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	state, err := launcher.getState()
+	if err != nil {
+		return nil, err
+	}
+	// only if the process itself failed is there a state worth returning
+	if finished.Error != "" {
+		return state, errors.New(finished.Error)
+	}
+	return state, nil
+}
+
+func (launcher *launcher) update(state *releaseState) (*releaseState, error) {
+	if state.Status == statusFatal {
+		return state, fmt.Errorf("release '%s' is in a fatal state: %s", launcher.id, state.Error)
+	}
+
+	if state.Internal != nil && state.Internal.InstallPath != "" {
+		var err error
+		if state, err = launcher.await("check_for_updates"); err != nil {
+			return state, fmt.Errorf("error checking for updates: %w", err)
+		}
+
+		if state.Internal == nil || state.Internal.LatestVersion == "" || state.Version == state.Internal.LatestVersion {
+			return state, nil
+		}
+	}
+
+	state, err := launcher.await("install")
+	if err != nil {
+		return state, fmt.Errorf("error installing: %w", err)
+	}
+	return state, nil
+}
+
+// `Launch` connects to the daemon at `socket`, optionally updates
+// the release and then replaces the current process with Discord.
+// Updating is best-effort: if it fails or takes longer than the
+// timeout, Discord is launched anyway if it's installed. Thus,
+// `Launch` only returns if Discord can't be executed at all.
+func Launch(socket string, id string, options LaunchOptions) error {
+	pathName, err := getPathName(id)
+	if err != nil {
+		return err
+	}
+
+	if options.Timeout <= 0 {
+		options.Timeout = DefaultLaunchTimeout
+	}
+
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return fmt.Errorf("error connecting to daemon at '%s': %w", socket, err)
+	}
+	defer conn.Close()
+
+	launcher := &launcher{
+		id:       id,
+		conn:     conn,
+		reader:   bufio.NewReader(conn),
+		deadline: time.Now().Add(options.Timeout),
+	}
+
+	if err = conn.SetReadDeadline(launcher.deadline); err != nil {
+		return fmt.Errorf("error setting read deadline: %w", err)
+	}
+
+	state, err := launcher.getState()
+	if err != nil {
+		return err
+	}
+
+	if options.Update {
+		updated, err := launcher.update(state)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error updating %s - launching as normal: %s\n", id, err)
+		}
+		if updated != nil {
+			state = updated
+		}
+	}
+
+	if state.Internal == nil || state.Internal.InstallPath == "" {
+		return fmt.Errorf("release '%s' is not installed, so cannot launch", id)
+	}
+
+	executable := filepath.Join(state.Internal.InstallPath, pathName, pathName)
+	argv := append(slices.Clone(state.Internal.Wrapper), executable)
+	argv = append(argv, state.Internal.Arguments...)
+	argv = append(argv, options.Arguments...)
+
+	// when there's a wrapper, it's the wrapper that's executed, which in turn executes Discord
+	path := executable
+	if len(state.Internal.Wrapper) > 0 {
+		if path, err = exec.LookPath(argv[0]); err != nil {
+			return fmt.Errorf("error finding wrapper command '%s': %w", argv[0], err)
+		}
+	}
+
+	conn.Close()
+	if err = syscall.Exec(path, argv, mergeEnvironment(state.Internal.Environment)); err != nil {
+		return fmt.Errorf("error launching '%s': %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,327 @@
+package dislaunch
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// Moving within the same filesystem is just a rename. Otherwise,
+// the installation is copied to the new location and verified
+// before the old one is removed, so that if anything goes wrong
+// (including being cancelled) the old installation is untouched
+// and the copy can simply be removed to roll back.
+
+type moveEntry struct {
+	path string // relative to the root being moved
+	info fs.FileInfo
+}
+
+type mover struct {
+	ctx      context.Context
+	source   string
+	target   string
+	entries  []moveEntry
+	total    int64
+	done     int64
+	progress func(message string, progress uint8)
+	// Files that were reflinked share their extents with the
+	// source, so their contents don't need to be verified
+	reflinked map[string]bool
+	hashes    map[string][]byte
+}
+
+func (mover *mover) report(message string) {
+	if mover.total == 0 {
+		mover.progress(message, 101)
+		return
+	}
+	mover.progress(message, uint8(float64(mover.done)/float64(mover.total)*100))
+}
+
+func (mover *mover) scan() error {
+	return filepath.Walk(mover.source, func(path string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relative, err := filepath.Rel(mover.source, path)
+		if err != nil {
+			return err
+		}
+
+		mover.entries = append(mover.entries, moveEntry{relative, info})
+		if info.Mode().IsRegular() {
+			mover.total += info.Size()
+		}
+		return nil
+	})
+}
+
+// `copyContents` copies `source` into `destination` in chunks so that
+// progress can be reported and cancellation checked, hashing what it
+// reads along the way for verification
+func (mover *mover) copyContents(source *os.File, destination *os.File, hash hash.Hash) error {
+	buffer := make([]byte, 32*1024)
+	for {
+		select {
+		case <-mover.ctx.Done():
+			return mover.ctx.Err()
+		default:
+		}
+
+		n, err := source.Read(buffer)
+		if n > 0 {
+			if _, err := destination.Write(buffer[:n]); err != nil {
+				return err
+			}
+			hash.Write(buffer[:n])
+			mover.done += int64(n)
+			mover.report("Copying to " + destination.Name())
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (mover *mover) copyFile(entry moveEntry) error {
+	source, err := os.Open(filepath.Join(mover.source, entry.path))
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	destination, err := os.OpenFile(filepath.Join(mover.target, entry.path), os.O_CREATE|os.O_EXCL|os.O_WRONLY, entry.info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	defer destination.Close()
+
+	// Filesystems such as Btrfs and XFS can share extents between
+	// files, which is near enough instant and takes up no extra
+	// space. Anything else falls back to actually copying.
+	if err = unix.IoctlFileClone(int(destination.Fd()), int(source.Fd())); err == nil {
+		mover.reflinked[entry.path] = true
+		mover.done += entry.info.Size()
+		mover.report("Copying to " + destination.Name())
+	} else {
+		hash := sha256.New()
+		if err = mover.copyContents(source, destination, hash); err != nil {
+			return err
+		}
+		mover.hashes[entry.path] = hash.Sum(nil)
+	}
+
+	if err = destination.Sync(); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (mover *mover) copy() error {
+	for _, entry := range mover.entries {
+		select {
+		case <-mover.ctx.Done():
+			return mover.ctx.Err()
+		default:
+		}
+
+		path := filepath.Join(mover.target, entry.path)
+		mode := entry.info.Mode()
+		switch {
+		case mode.IsDir():
+			// created writable so that its contents can be copied, and given its real permissions once they have been
+			if err := os.Mkdir(path, 0700); err != nil {
+				return fmt.Errorf("error creating directory '%s': %w", path, err)
+			}
+		case mode&fs.ModeSymlink != 0:
+			target, err := os.Readlink(filepath.Join(mover.source, entry.path))
+			if err != nil {
+				return fmt.Errorf("error reading symlink '%s': %w", entry.path, err)
+			}
+			if err = os.Symlink(target, path); err != nil {
+				return fmt.Errorf("error creating symlink '%s': %w", path, err)
+			}
+		case mode.IsRegular():
+			if err := mover.copyFile(entry); err != nil {
+				return fmt.Errorf("error copying '%s': %w", entry.path, err)
+			}
+		default:
+			return fmt.Errorf("cannot copy irregular file '%s'", entry.path)
+		}
+	}
+
+	// in reverse, so that a directory's modification time isn't
+	// changed by anything being done to its contents afterwards
+	for _, entry := range slices.Backward(mover.entries) {
+		if entry.info.Mode()&fs.ModeSymlink != 0 {
+			continue
+		}
+
+		path := filepath.Join(mover.target, entry.path)
+		if err := os.Chmod(path, entry.info.Mode().Perm()); err != nil {
+			return fmt.Errorf("error setting permissions of '%s': %w", path, err)
+		}
+		if err := os.Chtimes(path, entry.info.ModTime(), entry.info.ModTime()); err != nil {
+			return fmt.Errorf("error setting times of '%s': %w", path, err)
+		}
+	}
+
+	return nil
+}
+
+func (mover *mover) verify() error {
+	mover.done = 0
+	for _, entry := range mover.entries {
+		select {
+		case <-mover.ctx.Done():
+			return mover.ctx.Err()
+		default:
+		}
+
+		path := filepath.Join(mover.target, entry.path)
+		info, err := os.Lstat(path)
+		if err != nil {
+			return err
+		}
+		if info.Mode().Type() != entry.info.Mode().Type() {
+			return fmt.Errorf("'%s' has the wrong type", path)
+		}
+		if !info.Mode().IsRegular() {
+			continue
+		}
+		if info.Size() != entry.info.Size() {
+			return fmt.Errorf("'%s' has size %d instead of %d", path, info.Size(), entry.info.Size())
+		}
+
+		if mover.reflinked[entry.path] {
+			mover.done += info.Size()
+			continue
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		hash := sha256.New()
+		_, err = io.Copy(hash, file)
+		file.Close()
+		if err != nil {
+			return fmt.Errorf("error reading '%s': %w", path, err)
+		}
+		if !bytes.Equal(hash.Sum(nil), mover.hashes[entry.path]) {
+			return fmt.Errorf("'%s' differs from the original", path)
+		}
+
+		mover.done += info.Size()
+		mover.report("Verifying " + path)
+	}
+	return nil
+}
+
+func (release *release) move(path string) (result error) {
+	internal, reset, err := release.takeOver()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		result = reset()
+	}()
+
+	if internal.InstallPath == "" {
+		return
+	}
+
+	oldPath := filepath.Join(internal.InstallPath, release.pathName)
+	newPath := filepath.Join(path, release.pathName)
+
+	release.status = statusMove
+	release.message = "Moving to " + newPath
+	release.progress = 101
+	release.flush(internal, true)
+
+	// renaming would replace an empty directory, and the copy's rollback would remove a non-empty one
+	if _, err := os.Lstat(newPath); !errors.Is(err, os.ErrNotExist) {
+		release.err = fmt.Errorf("error moving release '%s' to '%s': '%s' already exists", release, path, newPath)
+		return
+	}
+
+	err = os.Rename(oldPath, newPath)
+	if err == nil {
+		internal.InstallPath = path
+		return
+	}
+
+	if !errors.Is(err, syscall.EXDEV) {
+		release.err = fmt.Errorf("error moving release '%s' to '%s': %w", release, path, err)
+		return
+	}
+
+	mover := &mover{
+		ctx:    release.ctx,
+		source: oldPath,
+		target: newPath,
+		progress: func(message string, progress uint8) {
+			release.message = message
+			release.progress = progress
+			release.flush(internal, true)
+		},
+		reflinked: make(map[string]bool),
+		hashes:    make(map[string][]byte),
+	}
+
+	rollback := func(err error) {
+		release.err = err
+		release.message = "Rolling back"
+		release.progress = 101
+		release.flush(internal, true)
+		if err := os.RemoveAll(newPath); err != nil {
+			release.err = fmt.Errorf("error rolling back copy at '%s': %w", newPath, err)
+		}
+	}
+
+	if err = mover.scan(); err != nil {
+		release.err = fmt.Errorf("error reading release '%s' at '%s': %w", release, oldPath, err)
+		return
+	}
+
+	if err = mover.copy(); err != nil {
+		rollback(fmt.Errorf("error copying release '%s' to '%s': %w", release, path, err))
+		return
+	}
+
+	if err = mover.verify(); err != nil {
+		rollback(fmt.Errorf("error verifying copy of release '%s' at '%s': %w", release, path, err))
+		return
+	}
+
+	// The copy is now the installation, so it's committed before
+	// removing the old one in case removing it is interrupted
+	internal.InstallPath = path
+	if release.setInternal(internal) != nil {
+		return
+	}
+
+	release.message = "Removing " + oldPath
+	release.progress = 101
+	release.flush(internal, true)
+	if err = os.RemoveAll(oldPath); err != nil {
+		release.err = fmt.Errorf("error removing previous install path '%s': %w", oldPath, err)
+	}
+	return
+}
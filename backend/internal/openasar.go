@@ -0,0 +1,147 @@
+package dislaunch
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Unlike the client mods handled by injectors, OpenAsar replaces
+// `resources/app.asar` altogether. The original is kept alongside
+// it so that it can be restored when OpenAsar is disabled.
+
+func copyFile(source string, destination string) error {
+	sourceFile, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer sourceFile.Close()
+
+	destinationFile, err := os.OpenFile(destination, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer destinationFile.Close()
+
+	if _, err = io.Copy(destinationFile, sourceFile); err != nil {
+		return err
+	}
+	return destinationFile.Sync()
+}
+
+// `applyOpenAsar` brings `app.asar` in line with `internal.OpenAsar`.
+// `extracted` must be set when Discord has just been (re)installed,
+// as `app.asar` is then Discord's original again and any previous
+// backup of it is outdated.
+func (release *release) applyOpenAsar(internal *releaseInternal, extracted bool) error {
+	resources := filepath.Join(internal.InstallPath, release.pathName, "resources")
+	appAsar := filepath.Join(resources, "app.asar")
+	backup := filepath.Join(resources, "app.asar.orig")
+
+	_, err := os.Stat(backup)
+	backedUp := err == nil
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("error getting stat of '%s': %w", backup, err)
+	}
+
+	if !internal.OpenAsar {
+		if !backedUp {
+			return nil
+		}
+
+		// the backup is of the previous version's `app.asar`
+		if extracted {
+			if err = os.Remove(backup); err != nil {
+				return fmt.Errorf("error removing outdated backup of app.asar: %w", err)
+			}
+			return nil
+		}
+
+		release.message = "Restoring original app.asar"
+		release.flush(internal, true)
+		if err = os.Rename(backup, appAsar); err != nil {
+			return fmt.Errorf("error restoring original app.asar: %w", err)
+		}
+		return nil
+	}
+
+	if extracted || !backedUp {
+		release.message = "Backing up original app.asar"
+		release.flush(internal, true)
+		if err = copyFile(appAsar, backup); err != nil {
+			return fmt.Errorf("error backing up original app.asar: %w", err)
+		}
+	}
+
+	openAsar, _, err := getGithubClient().Repositories.GetReleaseByTag(release.ctx, "GooseMod", "OpenAsar", "nightly")
+	if err != nil {
+		return fmt.Errorf("error getting latest OpenAsar release: %w", err)
+	}
+
+	for _, asset := range openAsar.Assets {
+		if asset.GetName() != "app.asar" {
+			continue
+		}
+
+		// downloaded alongside and renamed over so that Discord
+		// is never left with a partially downloaded `app.asar`
+		downloadPath := appAsar + ".part"
+		file, err := os.OpenFile(downloadPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+		if err != nil {
+			return fmt.Errorf("error opening '%s': %w", downloadPath, err)
+		}
+		defer file.Close()
+
+		release.message = "Downloading OpenAsar"
+		release.flush(internal, true)
+		if err = download(release.ctx, asset.GetBrowserDownloadURL(), file, func(progress uint8) {
+			release.progress = progress
+			release.flush(internal, true)
+		}); err != nil {
+			os.Remove(downloadPath)
+			return fmt.Errorf("error downloading OpenAsar: %w", err)
+		}
+		if err = validateAsar(downloadPath); err != nil {
+			os.Remove(downloadPath)
+			return fmt.Errorf("downloaded OpenAsar is invalid: %w", err)
+		}
+
+		if err = os.Rename(downloadPath, appAsar); err != nil {
+			os.Remove(downloadPath)
+			return fmt.Errorf("error replacing app.asar with OpenAsar: %w", err)
+		}
+		return nil
+	}
+
+	return errors.New("OpenAsar release has no app.asar")
+}
+
+func (release *release) setOpenAsar(openAsar bool) (result error) {
+	internal, reset, err := release.takeOver()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		result = reset()
+	}()
+
+	previous := internal.OpenAsar
+	internal.OpenAsar = openAsar
+
+	// otherwise it's applied once installed
+	if internal.InstallPath == "" {
+		return
+	}
+
+	release.status = statusOpenAsar
+	release.progress = 101
+	release.flush(internal, true)
+
+	if err := release.applyOpenAsar(internal, false); err != nil {
+		internal.OpenAsar = previous
+		release.err = err
+	}
+	return
+}
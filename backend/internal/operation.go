@@ -0,0 +1,294 @@
+package dislaunch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"sync"
+	"time"
+)
+
+// An "operation" is a single run of a process, e.g. one `install`.
+// Every process is started as an operation so that it can be
+// listed, waited on and cancelled by its ID, which (unlike the
+// release's status) stays meaningful after it has finished.
+// Each release has a queue of operations, which run one at a time
+// in the order they were queued. Otherwise, processes started at
+// once (e.g. `install`, which also applies the client mod once it's
+// finished, and an `applyBd` of its own) would all contend for the
+// release's lock and run in no particular order.
+
+// How many finished operations are kept for listing and waiting on
+const maxFinishedOperations = 32
+
+type operation struct {
+	Id       uint64    `json:"id"`
+	Kind     string    `json:"kind"` // the name of the process, as in the socket command that starts it
+	Release  string    `json:"release"`
+	Params   any       `json:"params"`
+	Queued   time.Time `json:"queued"`
+	Started  time.Time `json:"started"` // zero until it's started running
+	Finished time.Time `json:"finished"`
+	Message  string    `json:"message"`
+	Progress uint8     `json:"progress"` // indeterminate progress when 101
+	Result   any       `json:"result"`
+	Error    string    `json:"error"`
+
+	ctx     context.Context
+	cancel  context.CancelFunc
+	done    chan struct{}
+	err     error
+	process func() (any, error)
+}
+
+var operations struct {
+	mu   sync.Mutex
+	next uint64
+	list []*operation
+}
+
+var (
+	errOperationNotFound = errors.New("operation not found")
+	errOperationRemoved  = errors.New("operation was removed from the queue before it started")
+)
+
+// `start` queues `process` as an operation, which starts once the
+// operations queued before it have finished, returning immediately.
+// If the last operation queued is of the same kind with the same
+// `params`, that operation is returned instead, as running both
+// would only do the same thing twice. Earlier operations aren't
+// considered, as whatever was queued after them may undo them.
+func (release *release) start(kind string, params any, process func() (any, error)) *operation {
+	release.queueMu.Lock()
+	defer release.queueMu.Unlock()
+
+	if len(release.queue) != 0 {
+		last := release.queue[len(release.queue)-1]
+		if last.Kind == kind && reflect.DeepEqual(last.Params, params) {
+			return last
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	operation := &operation{
+		Kind:    kind,
+		Release: release.id,
+		Params:  params,
+		Queued:  time.Now(),
+		ctx:     ctx,
+		cancel:  cancel,
+		done:    make(chan struct{}),
+		process: process,
+	}
+
+	operations.mu.Lock()
+	operations.next++
+	operation.Id = operations.next
+	operations.list = append(operations.list, operation)
+	operations.mu.Unlock()
+
+	release.queue = append(release.queue, operation)
+	if !release.working {
+		release.working = true
+		go release.work()
+	}
+	release.flushQueue()
+	return operation
+}
+
+// `work` runs queued operations one after another until the queue
+// is empty
+func (release *release) work() {
+	for {
+		release.queueMu.Lock()
+		if len(release.queue) == 0 {
+			release.working = false
+			release.queueMu.Unlock()
+			return
+		}
+		operation := release.queue[0]
+		release.queue = release.queue[1:]
+
+		operations.mu.Lock()
+		operation.Started = time.Now()
+		operations.mu.Unlock()
+		release.flushQueue()
+		release.queueMu.Unlock()
+
+		release.mu.Lock()
+		release.operation = operation
+		release.mu.Unlock()
+
+		var result any
+		// cancelled just as it was starting, in which case the process isn't run at all
+		err := operation.ctx.Err()
+		if err == nil {
+			result, err = operation.process()
+		}
+
+		release.mu.Lock()
+		release.operation = nil
+		release.mu.Unlock()
+
+		operation.finish(result, err)
+	}
+}
+
+// `flushQueue` updates the queue in the release's state without
+// waiting on the active process, if any. `queueMu` must be held.
+func (release *release) flushQueue() {
+	state := *release.getState()
+	state.Queue = release.getQueue()
+	release.state.Store(&state)
+	go broadcastBackendState()
+}
+
+// `getQueue` returns copies of the queued operations. `queueMu`
+// must be held.
+func (release *release) getQueue() []operation {
+	operations.mu.Lock()
+	defer operations.mu.Unlock()
+
+	queue := make([]operation, len(release.queue))
+	for i, operation := range release.queue {
+		queue[i] = *operation
+	}
+	return queue
+}
+
+// `dequeue` removes `operation` from the queue if it hasn't started
+// yet, reporting whether it was removed
+func (release *release) dequeue(operation *operation) bool {
+	release.queueMu.Lock()
+	defer release.queueMu.Unlock()
+
+	index := slices.Index(release.queue, operation)
+	if index == -1 {
+		return false
+	}
+	release.queue = slices.Delete(release.queue, index, index+1)
+	release.flushQueue()
+	return true
+}
+
+// `run` is `start`, but waits for the operation to finish
+func (release *release) run(kind string, params any, process func() (any, error)) (any, error) {
+	finished, _ := release.start(kind, params, process).wait(context.Background())
+	return finished.Result, finished.err
+}
+
+// `processResult` adapts processes which only return an error for `start`
+func processResult(process func() error) func() (any, error) {
+	return func() (any, error) {
+		return nil, process()
+	}
+}
+
+func (operation *operation) update(message string, progress uint8) {
+	operations.mu.Lock()
+	defer operations.mu.Unlock()
+	operation.Message = message
+	operation.Progress = progress
+}
+
+func (operation *operation) finish(result any, err error) {
+	operations.mu.Lock()
+	defer operations.mu.Unlock()
+
+	operation.Finished = time.Now()
+	operation.Result = result
+	operation.err = err
+	if err != nil {
+		operation.Error = err.Error()
+	}
+	operation.cancel()
+	close(operation.done)
+
+	pruneOperations()
+	finished := *operation
+	go queueEvent(event{Kind: eventOperationFinished, Release: operation.Release, Operation: &finished})
+}
+
+// `pruneOperations` forgets the oldest finished operations beyond
+// `maxFinishedOperations`. The lock must be held.
+func pruneOperations() {
+	finished := 0
+	for _, operation := range operations.list {
+		if !operation.Finished.IsZero() {
+			finished++
+		}
+	}
+	operations.list = slices.DeleteFunc(operations.list, func(operation *operation) bool {
+		if finished > maxFinishedOperations && !operation.Finished.IsZero() {
+			finished--
+			return true
+		}
+		return false
+	})
+}
+
+// `getOperations` returns copies of every operation of `release`, or
+// of every release if `release` is nil
+func getOperations(release *release) []operation {
+	operations.mu.Lock()
+	defer operations.mu.Unlock()
+
+	list := []operation{}
+	for _, operation := range operations.list {
+		if release == nil || operation.Release == release.id {
+			list = append(list, *operation)
+		}
+	}
+	return list
+}
+
+func findOperation(id uint64) (*operation, error) {
+	operations.mu.Lock()
+	defer operations.mu.Unlock()
+
+	index := slices.IndexFunc(operations.list, func(operation *operation) bool {
+		return operation.Id == id
+	})
+	if index == -1 {
+		return nil, fmt.Errorf("%w: %d", errOperationNotFound, id)
+	}
+	return operations.list[index], nil
+}
+
+func (operation *operation) snapshot() operation {
+	operations.mu.Lock()
+	defer operations.mu.Unlock()
+	return *operation
+}
+
+// `wait` waits until the operation has finished, or `ctx` is done,
+// returning a copy of it
+func (operation *operation) wait(ctx context.Context) (finished operation, err error) {
+	select {
+	case <-operation.done:
+		return operation.snapshot(), nil
+	case <-ctx.Done():
+		return finished, ctx.Err()
+	}
+}
+
+// `cancelOperation` cancels operation `id`, which is removed from
+// its release's queue if it hasn't started yet
+func cancelOperation(id uint64) error {
+	operation, err := findOperation(id)
+	if err != nil {
+		return err
+	}
+
+	operation.cancel()
+	release, err := getRelease(operation.Release)
+	if err != nil {
+		return err
+	}
+	if release.dequeue(operation) {
+		operation.finish(nil, errOperationRemoved)
+	}
+	return nil
+}
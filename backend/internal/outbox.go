@@ -0,0 +1,181 @@
+package dislaunch
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Messages to each connection are queued rather than handed straight
+// to its writer, so that sending never blocks on a slow client (and
+// with it every other client and whichever process is flushing its
+// state). The queue is bounded: a newer state replaces any state
+// still queued, and once the queue is full the oldest event is
+// dropped to make room, which the client notices as a gap in
+// sequence numbers. Responses and snapshots are never dropped.
+// Clients that stay too slow to keep up are disconnected.
+
+const maxQueuedMessages = 64
+
+// variables rather than constants so that tests can shorten them
+var (
+	writeTimeout = 5 * time.Second
+	// how long a client may keep the queue full before it's disconnected
+	slowClientTimeout = 30 * time.Second
+)
+
+type messageKind int
+
+const (
+	messageResponse messageKind = iota // kept until sent
+	messageState                       // replaces any queued state
+	messageEvent                       // dropped, oldest first, when the queue is full
+)
+
+type outgoing struct {
+	kind    messageKind
+	message []byte
+}
+
+type outbox struct {
+	mu       sync.Mutex
+	messages []outgoing
+	ready    chan struct{} // signalled when there are messages
+	// when the queue last became full without draining since, or zero
+	overflowing time.Time
+	closing     bool // set to close the connection once the queue has drained
+}
+
+func newOutbox() *outbox {
+	return &outbox{ready: make(chan struct{}, 1)}
+}
+
+// `send` queues `message` for the connection without waiting for it
+// to be written
+func (entry *connectionEntry) send(message []byte, kind messageKind) {
+	outbox := entry.outbox
+	outbox.mu.Lock()
+	defer outbox.mu.Unlock()
+
+	if entry.ctx.Err() != nil {
+		return
+	}
+
+	if kind == messageState {
+		outbox.messages = slices.DeleteFunc(outbox.messages, func(queued outgoing) bool {
+			return queued.kind == messageState
+		})
+	}
+
+	if len(outbox.messages) >= maxQueuedMessages {
+		if outbox.overflowing.IsZero() {
+			outbox.overflowing = time.Now()
+		} else if time.Since(outbox.overflowing) > slowClientTimeout {
+			log.Printf("Connection %p has been too slow to keep up for %s - disconnecting\n", entry.conn, slowClientTimeout)
+			entry.cancel()
+			return
+		}
+
+		index := slices.IndexFunc(outbox.messages, func(queued outgoing) bool {
+			return queued.kind != messageResponse
+		})
+		if index == -1 {
+			// nothing can be dropped, and responses are only queued as fast as the client makes requests
+			log.Printf("Connection %p has too many unread responses - disconnecting\n", entry.conn)
+			entry.cancel()
+			return
+		}
+		outbox.messages = slices.Delete(outbox.messages, index, index+1)
+	}
+
+	outbox.messages = append(outbox.messages, outgoing{kind, message})
+	select {
+	case outbox.ready <- struct{}{}:
+	default:
+	}
+}
+
+// `close` closes the connection once whatever's queued has been written
+func (entry *connectionEntry) close() {
+	entry.outbox.mu.Lock()
+	defer entry.outbox.mu.Unlock()
+
+	entry.outbox.closing = true
+	select {
+	case entry.outbox.ready <- struct{}{}:
+	default:
+	}
+}
+
+// `take` removes the oldest queued message from the queue, so that
+// everything still queued can be replaced or dropped until it's
+// written. Once there are none left, the writer has caught up.
+func (outbox *outbox) take() (next outgoing, exists bool, closing bool) {
+	outbox.mu.Lock()
+	defer outbox.mu.Unlock()
+
+	if len(outbox.messages) == 0 {
+		outbox.overflowing = time.Time{}
+		return outgoing{}, false, outbox.closing
+	}
+	next = outbox.messages[0]
+	outbox.messages = slices.Delete(outbox.messages, 0, 1)
+	return next, true, outbox.closing
+}
+
+func startWriter(entry *connectionEntry) {
+	for {
+		select {
+		case <-entry.ctx.Done():
+			return
+		case <-entry.outbox.ready:
+		}
+
+		for {
+			next, exists, closing := entry.outbox.take()
+			if !exists {
+				if closing {
+					entry.cancel()
+					return
+				}
+				break
+			}
+			if !entry.write(next) {
+				return
+			}
+		}
+	}
+}
+
+// `write` writes `outgoing` to the connection, returning false if
+// the connection is to be closed
+func (entry *connectionEntry) write(outgoing outgoing) bool {
+	if entry.ctx.Err() != nil {
+		return false
+	}
+
+	if err := entry.conn.SetWriteDeadline(time.Now().Add(writeTimeout)); err != nil {
+		fmt.Fprintf(os.Stderr, "error setting write deadline: %s\n", err)
+	}
+
+	if _, err := entry.conn.Write(outgoing.message); err != nil {
+		if errors.Is(err, syscall.EPIPE) || errors.Is(err, syscall.ECONNRESET) {
+			entry.cancel()
+			return false
+		}
+		// part of the message may have been written, so nothing else can be
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			log.Printf("Connection %p hasn't read anything for %s - disconnecting\n", entry.conn, writeTimeout)
+			entry.cancel()
+			return false
+		}
+
+		fmt.Fprintf(os.Stderr, "error writing to connection: %s\nMessage: %s", err, outgoing.message)
+	}
+	return true
+}
@@ -0,0 +1,229 @@
+package dislaunch
+
+import (
+	"bufio"
+	"context"
+	"encoding/json/v2"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// `newTestEntry` returns a connection whose writer is running, and
+// the other end of it, which nothing reads from until the test does
+func newTestEntry(t *testing.T) (*connectionEntry, net.Conn) {
+	t.Helper()
+
+	server, client := net.Pipe()
+	ctx, cancel := context.WithCancel(context.Background())
+	entry := &connectionEntry{
+		conn:   server,
+		ctx:    ctx,
+		cancel: cancel,
+		outbox: newOutbox(),
+	}
+	entry.wg.Go(func() {
+		startWriter(entry)
+	})
+	t.Cleanup(func() {
+		cancel()
+		client.Close()
+		entry.wg.Wait()
+		server.Close()
+	})
+	return entry, client
+}
+
+// `setTimeouts` shortens the outbox's timeouts for the rest of the test
+func setTimeouts(t *testing.T, write time.Duration, slowClient time.Duration) {
+	t.Helper()
+
+	previousWrite, previousSlowClient := writeTimeout, slowClientTimeout
+	writeTimeout, slowClientTimeout = write, slowClient
+	t.Cleanup(func() {
+		writeTimeout, slowClientTimeout = previousWrite, previousSlowClient
+	})
+}
+
+// `stall` sends a message that the writer then blocks on writing,
+// as nothing is reading from the other end of the pipe, so that
+// everything sent afterwards stays queued
+func stall(t *testing.T, entry *connectionEntry) {
+	t.Helper()
+
+	entry.send([]byte("stall\n"), messageResponse)
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(time.Millisecond) {
+		entry.outbox.mu.Lock()
+		queued := len(entry.outbox.messages)
+		entry.outbox.mu.Unlock()
+		if queued == 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("writer never took the first message")
+		}
+	}
+}
+
+// `readLines` reads `count` lines from `conn`
+func readLines(t *testing.T, conn net.Conn, count int) []string {
+	t.Helper()
+
+	if err := conn.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	reader := bufio.NewReader(conn)
+	lines := make([]string, 0, count)
+	for range count {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("error reading line %d of %d: %s", len(lines)+1, count, err)
+		}
+		lines = append(lines, strings.TrimSuffix(line, "\n"))
+	}
+	return lines
+}
+
+func sendEvent(t *testing.T, entry *connectionEntry) {
+	t.Helper()
+
+	container.mu.Lock()
+	message, err := encodeEvent(entry, event{Kind: eventProgress})
+	container.mu.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry.send(message, messageEvent)
+}
+
+func TestOutboxCoalescesStates(t *testing.T) {
+	entry, client := newTestEntry(t)
+	stall(t, entry)
+
+	entry.send([]byte("state 1\n"), messageState)
+	entry.send([]byte("response\n"), messageResponse)
+	entry.send([]byte("state 2\n"), messageState)
+	entry.send([]byte("state 3\n"), messageState)
+
+	lines := readLines(t, client, 3)
+	if expected := []string{"stall", "response", "state 3"}; strings.Join(lines, ",") != strings.Join(expected, ",") {
+		t.Errorf("read %q, want %q", lines, expected)
+	}
+}
+
+func TestOutboxDropsOldestEvents(t *testing.T) {
+	entry, client := newTestEntry(t)
+	stall(t, entry)
+
+	const dropped = 10
+	for range maxQueuedMessages + dropped {
+		sendEvent(t, entry)
+	}
+
+	lines := readLines(t, client, 1+maxQueuedMessages)
+	var previous uint64
+	for i, line := range lines[1:] {
+		var notification eventNotification
+		if err := json.Unmarshal([]byte(line), &notification); err != nil {
+			t.Fatalf("error decoding %q: %s", line, err)
+		}
+		seq := notification.Params.Seq
+
+		// the oldest were dropped, so the client sees a gap before what's left
+		if i == 0 && seq != dropped+1 {
+			t.Errorf("first event read has seq %d, want %d", seq, dropped+1)
+		}
+		if i != 0 && seq != previous+1 {
+			t.Errorf("event with seq %d follows %d", seq, previous)
+		}
+		previous = seq
+	}
+	if entry.ctx.Err() != nil {
+		t.Error("connection was closed for overflowing once")
+	}
+}
+
+func TestOutboxKeepsResponsesAndSnapshots(t *testing.T) {
+	entry, client := newTestEntry(t)
+	stall(t, entry)
+
+	// snapshots are sent as responses, so that they're kept
+	entry.send([]byte("response\n"), messageResponse)
+	entry.send([]byte("snapshot\n"), messageResponse)
+	for range maxQueuedMessages * 2 {
+		sendEvent(t, entry)
+	}
+
+	lines := readLines(t, client, 1+maxQueuedMessages)
+	if lines[1] != "response" || lines[2] != "snapshot" {
+		t.Errorf("read %q and %q first, want the response and snapshot", lines[1], lines[2])
+	}
+}
+
+func TestOutboxDisconnectsSlowClients(t *testing.T) {
+	setTimeouts(t, time.Minute, 50*time.Millisecond)
+	entry, _ := newTestEntry(t)
+	stall(t, entry)
+
+	for range maxQueuedMessages + 1 {
+		sendEvent(t, entry)
+	}
+	if entry.ctx.Err() != nil {
+		t.Fatal("connection was closed as soon as the queue was full")
+	}
+	time.Sleep(100 * time.Millisecond)
+	sendEvent(t, entry)
+	if entry.ctx.Err() == nil {
+		t.Error("connection is still open after keeping the queue full for longer than the timeout")
+	}
+}
+
+func TestOutboxDisconnectsStalledClients(t *testing.T) {
+	setTimeouts(t, 50*time.Millisecond, time.Minute)
+	entry, _ := newTestEntry(t)
+
+	entry.send([]byte("unread\n"), messageResponse)
+	select {
+	case <-entry.ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Error("connection is still open after a write timed out")
+	}
+}
+
+func TestOutboxDoesNotBlockOtherConnections(t *testing.T) {
+	slow, _ := newTestEntry(t)
+	fast, client := newTestEntry(t)
+	stall(t, slow)
+
+	const count = maxQueuedMessages * 4
+	last := fmt.Sprintf("state %d", count-1)
+	received := make(chan error, 1)
+	go func() {
+		// states replace those not yet written, so only the last is certain to arrive
+		reader := bufio.NewReader(client)
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil || line == last+"\n" {
+				received <- err
+				return
+			}
+		}
+	}()
+
+	for i := range count {
+		for _, entry := range []*connectionEntry{slow, fast} {
+			entry.send(fmt.Appendf(nil, "state %d\n", i), messageState)
+		}
+	}
+
+	select {
+	case err := <-received:
+		if err != nil {
+			t.Errorf("error reading from connection: %s", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("broadcasts to one connection were held up by another")
+	}
+}
@@ -0,0 +1,106 @@
+package dislaunch
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"slices"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// Anyone able to connect to the socket can control the daemon, so
+// the socket is only accessible to the user, and connections from
+// any other user are refused unless they're in `AllowedUids`. If
+// any are, the socket is also made accessible to the user's group,
+// which those users must then be in, as must the runtime directory
+// be. That's done here only for the fallback runtime directory:
+// `XDG_RUNTIME_DIR` holds other programs' sockets, which may rely
+// on it being inaccessible to anyone else, so the user must grant
+// access to it themselves.
+
+// `setSocketPermissions` makes `socket` and, if it's the daemon's
+// own, `directory` accessible to the user's group if any other
+// users are allowed to connect, or only to the user otherwise
+func setSocketPermissions(directory string, socket string) error {
+	var socketMode, directoryMode os.FileMode = 0600, 0700
+	if len(getCachedConfiguration().AllowedUids) != 0 {
+		// only searchable, so that the group can't list or tamper with the directory
+		socketMode, directoryMode = 0660, 0710
+	}
+
+	if err := os.Chmod(socket, socketMode); err != nil {
+		return err
+	}
+	if os.Getenv("XDG_RUNTIME_DIR") != "" {
+		return nil
+	}
+	return os.Chmod(directory, directoryMode)
+}
+
+// `verifyRuntimeDirectory` checks that nobody else could have put
+// anything in `directory`, such as a socket of their own. This
+// matters when `XDG_RUNTIME_DIR` is unset and the directory is
+// instead in the shared temporary directory, where anyone may have
+// created it first.
+func verifyRuntimeDirectory(directory string) error {
+	info, err := os.Lstat(directory)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("runtime directory '%s' is not a directory", directory)
+	}
+
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fmt.Errorf("cannot get owner of runtime directory '%s'", directory)
+	}
+	if int(stat.Uid) != os.Getuid() {
+		return fmt.Errorf("runtime directory '%s' is owned by UID %d rather than the user", directory, stat.Uid)
+	}
+	if info.Mode().Perm()&0002 != 0 {
+		return fmt.Errorf("runtime directory '%s' is writable by anyone", directory)
+	}
+	return nil
+}
+
+func getPeerUid(conn net.Conn) (int, error) {
+	unixConn, ok := conn.(*net.UnixConn)
+	if !ok {
+		return 0, errors.New("not a Unix socket connection")
+	}
+	raw, err := unixConn.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+
+	var ucred *unix.Ucred
+	var credErr error
+	if err = raw.Control(func(fd uintptr) {
+		ucred, credErr = unix.GetsockoptUcred(int(fd), unix.SOL_SOCKET, unix.SO_PEERCRED)
+	}); err != nil {
+		return 0, err
+	}
+	if credErr != nil {
+		return 0, credErr
+	}
+	return int(ucred.Uid), nil
+}
+
+// `verifyPeer` checks that whoever's on the other end of `conn` is
+// the user or one allowed by the configuration. The cached
+// configuration is used, as it's called for every connection
+// accepted, and reading the file means waiting on its lock.
+func verifyPeer(conn net.Conn) error {
+	uid, err := getPeerUid(conn)
+	if err != nil {
+		return fmt.Errorf("error getting peer credentials: %w", err)
+	}
+	if uid == os.Getuid() || slices.Contains(getCachedConfiguration().AllowedUids, uid) {
+		return nil
+	}
+	return fmt.Errorf("UID %d is not allowed to connect", uid)
+}
@@ -0,0 +1,540 @@
+package dislaunch
+
+import (
+	"context"
+	"encoding/json/jsontext"
+	"encoding/json/v2"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+)
+
+// Besides the original text commands, the socket speaks JSON-RPC 2.0
+// (https://www.jsonrpc.org/specification), one message per line. Any
+// line beginning with `{` is taken to be a request; anything else is
+// a legacy text command, which is translated into a request so that
+// both are handled the same way, though only JSON-RPC requests are
+// ever answered. Requests are answered once whatever they started
+// has finished, so that clients learn whether it succeeded.
+//
+// `protocolVersion` is bumped whenever methods or their parameters
+// change incompatibly.
+const protocolVersion = 1
+
+// Error codes, from -32000 to -32099 being reserved for the implementation
+const (
+	codeParseError     = -32700
+	codeInvalidRequest = -32600
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+	codeInternalError  = -32603
+	// The process a request started finished with an error
+	codeProcessFailed = -32000
+	// The release is in a fatal state, so no process can be started
+	codeFatal = -32001
+)
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (err *rpcError) Error() string {
+	return err.Message
+}
+
+func invalidParams(format string, a ...any) *rpcError {
+	return &rpcError{Code: codeInvalidParams, Message: fmt.Sprintf(format, a...)}
+}
+
+type rpcRequest struct {
+	JsonRpc string         `json:"jsonrpc"`
+	Id      jsontext.Value `json:"id,omitzero"` // absent for notifications, which aren't answered
+	Method  string         `json:"method"`
+	Params  jsontext.Value `json:"params,omitzero"`
+}
+
+type rpcResponse struct {
+	JsonRpc string         `json:"jsonrpc"`
+	Id      jsontext.Value `json:"id"`
+	Result  jsontext.Value `json:"result,omitzero"`
+	Error   *rpcError      `json:"error,omitzero"`
+}
+
+type method func(ctx context.Context, params jsontext.Value) (any, error)
+
+// `withParams` decodes a method's parameters into `P`, rejecting
+// any it doesn't know of
+func withParams[P any](call func(ctx context.Context, params P) (any, error)) method {
+	return func(ctx context.Context, raw jsontext.Value) (any, error) {
+		var params P
+		if len(raw) != 0 {
+			if err := json.Unmarshal(raw, &params, json.RejectUnknownMembers(true)); err != nil {
+				return nil, invalidParams("invalid params: %s", err)
+			}
+		}
+		return call(ctx, params)
+	}
+}
+
+type releaseParams struct {
+	Release string `json:"release"`
+	// Answer as soon as the operation has been started, with the
+	// operation, rather than once it has finished
+	Detach bool `json:"detach"`
+}
+
+func getRelease(id string) (*release, error) {
+	switch id {
+	case "stable":
+		return getStable(), nil
+	case "ptb":
+		return getPtb(), nil
+	case "canary":
+		return getCanary(), nil
+	default:
+		return nil, invalidParams("unknown release: '%s'", id)
+	}
+}
+
+func (params *releaseParams) getReleaseParams() *releaseParams {
+	return params
+}
+
+// `releaseMethod` is `withParams` for methods of a release, which
+// start an operation of `kind` and, unless detached, finish once it
+// has. `P` must embed `releaseParams`.
+func releaseMethod[P any, PP interface {
+	*P
+	getReleaseParams() *releaseParams
+}](kind string, call func(release *release, params P) (any, error)) method {
+	return withParams(func(ctx context.Context, params P) (any, error) {
+		common := PP(&params).getReleaseParams()
+		release, err := getRelease(common.Release)
+		if err != nil {
+			return nil, err
+		}
+		if state := release.getState(); state.Status == statusFatal {
+			return nil, &rpcError{Code: codeFatal, Message: state.Error}
+		}
+
+		// `Detach` only affects how the request is answered, so isn't a parameter of the operation
+		detach := common.Detach
+		common.Detach = false
+		operation := release.start(kind, params, func() (any, error) {
+			return call(release, params)
+		})
+		if detach {
+			return operation.snapshot(), nil
+		}
+
+		finished, err := operation.wait(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if finished.err != nil {
+			var rpcErr *rpcError
+			if errors.As(finished.err, &rpcErr) {
+				return nil, rpcErr
+			}
+			return nil, &rpcError{Code: codeProcessFailed, Message: finished.err.Error()}
+		}
+		return finished.Result, nil
+	})
+}
+
+type enabledParams struct {
+	releaseParams
+	Enabled bool `json:"enabled"`
+}
+
+type bdApplyParams struct {
+	releaseParams
+	Force bool `json:"force"`
+}
+
+type bdChannelParams struct {
+	releaseParams
+	Channel bdChannel `json:"channel"`
+}
+
+type bdPinParams struct {
+	releaseParams
+	Tag string `json:"tag"`
+}
+
+type injectorParams struct {
+	releaseParams
+	Injector string `json:"injector"`
+}
+
+type argumentsParams struct {
+	releaseParams
+	Arguments []string `json:"arguments"`
+}
+
+type environmentParams struct {
+	releaseParams
+	Name  string  `json:"name"`
+	Value *string `json:"value"` // unsets the variable when absent
+}
+
+type wrapperParams struct {
+	releaseParams
+	Command []string `json:"command"`
+}
+
+type inspectParams struct {
+	releaseParams
+	Paths []string `json:"paths"`
+}
+
+type moveParams struct {
+	releaseParams
+	Path string `json:"path"`
+}
+
+type uninstallParams struct {
+	releaseParams
+	Trash  bool         `json:"trash"`
+	DryRun bool         `json:"dry_run"`
+	Purge  []purgeScope `json:"purge"`
+}
+
+// Options left absent are left unchanged
+type configParams struct {
+	AutomaticallyCheckForUpdates *bool   `json:"automatically_check_for_updates"`
+	NotifyOnUpdateAvailable      *bool   `json:"notify_on_update_available"`
+	AutomaticallyInstallUpdates  *bool   `json:"automatically_install_updates"`
+	DefaultInstallPath           *string `json:"default_install_path"`
+	GithubToken                  *string `json:"github_token"`
+	MaxBroadcastRate             *int    `json:"max_broadcast_rate"`
+}
+
+type addonInstallParams struct {
+	Kind   addonKind `json:"kind"`
+	Source string    `json:"source"`
+}
+
+type addonParams struct {
+	Name string `json:"name"`
+}
+
+type streamParams struct {
+	Enabled bool `json:"enabled"`
+}
+
+type operationListParams struct {
+	Release string `json:"release"` // every release's when empty
+}
+
+type operationParams struct {
+	Id uint64 `json:"id"`
+}
+
+// `finished` is the result of methods whose process only reports
+// failure, and whose results are otherwise seen in the state
+func finished(err error) (any, error) {
+	return nil, err
+}
+
+var methods = map[string]method{
+	"state": func(context.Context, jsontext.Value) (any, error) {
+		return getBackendState(), nil
+	},
+	"version": func(context.Context, jsontext.Value) (any, error) {
+		return getHello(), nil
+	},
+	"hello": withParams(clientHello),
+
+	"release.bd_apply": releaseMethod("bd_apply", func(release *release, params bdApplyParams) (any, error) {
+		return finished(release.applyBd(params.Force))
+	}),
+	"release.bd_enabled": releaseMethod("bd_enabled", func(release *release, params enabledParams) (any, error) {
+		return finished(release.setBdEnabled(params.Enabled))
+	}),
+	"release.bd_channel": releaseMethod("bd_channel", func(release *release, params bdChannelParams) (any, error) {
+		if params.Channel != bdStable && params.Channel != bdCanary {
+			return nil, invalidParams("unknown BetterDiscord channel: '%s'", params.Channel)
+		}
+		return finished(release.setBdChannel(params.Channel))
+	}),
+	"release.bd_changelog": releaseMethod("bd_changelog", func(release *release, params releaseParams) (any, error) {
+		changelog, err := release.getBdChangelog()
+		if err != nil {
+			return nil, err
+		}
+		return changelog, nil
+	}),
+	"release.bd_pin": releaseMethod("bd_pin", func(release *release, params bdPinParams) (any, error) {
+		if params.Tag == "" {
+			return nil, invalidParams("tag required for BetterDiscord pin")
+		}
+		return finished(release.setBdPin(params.Tag))
+	}),
+	"release.bd_unpin": releaseMethod("bd_unpin", func(release *release, params releaseParams) (any, error) {
+		return finished(release.unpinBd())
+	}),
+	"release.autostart": releaseMethod("autostart", func(release *release, params enabledParams) (any, error) {
+		return finished(release.setAutostart(params.Enabled))
+	}),
+	"release.autostart_minimized": releaseMethod("autostart_minimized", func(release *release, params enabledParams) (any, error) {
+		return finished(release.setAutostartMinimized(params.Enabled))
+	}),
+	"release.injector": releaseMethod("injector", func(release *release, params injectorParams) (any, error) {
+		if _, err := getInjector(params.Injector); err != nil {
+			return nil, invalidParams("%s", err)
+		}
+		return finished(release.setInjector(params.Injector))
+	}),
+	// not an operation itself, as it would only start once what it's cancelling had finished
+	"release.cancel": withParams(func(ctx context.Context, params releaseParams) (any, error) {
+		release, err := getRelease(params.Release)
+		if err != nil {
+			return nil, err
+		}
+		release.cancel.Load().(context.CancelFunc)()
+		return nil, nil
+	}),
+	"release.check_for_updates": releaseMethod("check_for_updates", func(release *release, params releaseParams) (any, error) {
+		return finished(release.checkForUpdates())
+	}),
+	"release.command_line_arguments": releaseMethod("command_line_arguments", func(release *release, params argumentsParams) (any, error) {
+		return finished(release.setCommandLineArguments(params.Arguments))
+	}),
+	"release.environment": releaseMethod("environment", func(release *release, params environmentParams) (any, error) {
+		if err := validateEnvironmentName(params.Name); err != nil {
+			return nil, invalidParams("%s", err)
+		}
+		return finished(release.setEnvironment(params.Name, params.Value))
+	}),
+	"release.wrapper": releaseMethod("wrapper", func(release *release, params wrapperParams) (any, error) {
+		return finished(release.setWrapper(params.Command))
+	}),
+	"release.inspect": releaseMethod("inspect", func(release *release, params inspectParams) (any, error) {
+		if err := release.inspect(params.Paths); err != nil {
+			return nil, err
+		}
+		return release.getState().Inspection, nil
+	}),
+	"release.install": releaseMethod("install", func(release *release, params releaseParams) (any, error) {
+		return finished(release.install())
+	}),
+	"release.move": releaseMethod("move", func(release *release, params moveParams) (any, error) {
+		if params.Path == "" {
+			return nil, invalidParams("path required to move release")
+		}
+		return finished(release.move(params.Path))
+	}),
+	"release.open_asar": releaseMethod("open_asar", func(release *release, params enabledParams) (any, error) {
+		return finished(release.setOpenAsar(params.Enabled))
+	}),
+	"release.uninstall": releaseMethod("uninstall", func(release *release, params uninstallParams) (any, error) {
+		options := uninstallOptions{trash: params.Trash, dryRun: params.DryRun}
+		if params.Purge != nil {
+			options.purge = make(map[purgeScope]bool)
+		}
+		for _, scope := range params.Purge {
+			if !slices.Contains(purgeScopes, scope) {
+				return nil, invalidParams("unknown purge scope: '%s'", scope)
+			}
+			options.purge[scope] = true
+		}
+
+		if err := release.uninstall(options); err != nil {
+			return nil, err
+		}
+		return release.getState().Removals, nil
+	}),
+
+	"config.set": withParams(func(ctx context.Context, params configParams) (any, error) {
+		// validated first so that nothing is set if anything is invalid
+		if params.MaxBroadcastRate != nil && *params.MaxBroadcastRate < 0 {
+			return nil, invalidParams("invalid maximum broadcast rate: %d", *params.MaxBroadcastRate)
+		}
+		if params.DefaultInstallPath != nil {
+			if err := validateInstallPath(*params.DefaultInstallPath); err != nil {
+				return nil, invalidParams("invalid default installation path: %s", err)
+			}
+		}
+
+		if params.DefaultInstallPath != nil {
+			if err := setDefaultInstallPath(*params.DefaultInstallPath); err != nil {
+				return nil, &rpcError{Code: codeInternalError, Message: err.Error()}
+			}
+		}
+
+		for _, set := range []struct {
+			setting *bool
+			set     func(bool) error
+		}{
+			{params.AutomaticallyCheckForUpdates, setAutomaticallyCheckForUpdates},
+			{params.NotifyOnUpdateAvailable, setNotifyOnUpdateAvailable},
+			{params.AutomaticallyInstallUpdates, setAutomaticallyInstallUpdates},
+		} {
+			if set.setting == nil {
+				continue
+			}
+			if err := set.set(*set.setting); err != nil {
+				return nil, &rpcError{Code: codeInternalError, Message: err.Error()}
+			}
+		}
+
+		if params.GithubToken != nil {
+			if err := setGithubToken(*params.GithubToken); err != nil {
+				return nil, &rpcError{Code: codeInternalError, Message: err.Error()}
+			}
+		}
+		if params.MaxBroadcastRate != nil {
+			if err := setMaxBroadcastRate(*params.MaxBroadcastRate); err != nil {
+				return nil, &rpcError{Code: codeInternalError, Message: err.Error()}
+			}
+		}
+		return nil, nil
+	}),
+
+	"addon.install": withParams(func(ctx context.Context, params addonInstallParams) (any, error) {
+		if params.Kind != addonPlugin && params.Kind != addonTheme {
+			return nil, invalidParams("unknown addon kind: '%s'", params.Kind)
+		}
+		if params.Source == "" {
+			return nil, invalidParams("source required to install addon")
+		}
+		return addonResult(installAddon(params.Kind, params.Source))
+	}),
+	"addon.update": withParams(func(ctx context.Context, params addonParams) (any, error) {
+		return addonResult(updateAddons(params.Name))
+	}),
+	"addon.remove": withParams(func(ctx context.Context, params addonParams) (any, error) {
+		if params.Name == "" {
+			return nil, invalidParams("name required to remove addon")
+		}
+		return addonResult(removeAddon(params.Name))
+	}),
+	"events.stream": withParams(func(ctx context.Context, params streamParams) (any, error) {
+		seq, err := streamEvents(ctx, params.Enabled)
+		if err != nil {
+			return nil, &rpcError{Code: codeInternalError, Message: err.Error()}
+		}
+		return map[string]uint64{"seq": seq}, nil
+	}),
+	"events.snapshot": func(ctx context.Context, _ jsontext.Value) (any, error) {
+		seq, err := resync(ctx)
+		if err != nil {
+			return nil, &rpcError{Code: codeInternalError, Message: err.Error()}
+		}
+		return map[string]uint64{"seq": seq}, nil
+	},
+
+	"subscribe": withParams(func(ctx context.Context, params subscriptionParams) (any, error) {
+		return setSubscription(ctx, params, true)
+	}),
+	"unsubscribe": withParams(func(ctx context.Context, params subscriptionParams) (any, error) {
+		return setSubscription(ctx, params, false)
+	}),
+
+	"operation.list": withParams(func(ctx context.Context, params operationListParams) (any, error) {
+		if params.Release == "" {
+			return getOperations(nil), nil
+		}
+		release, err := getRelease(params.Release)
+		if err != nil {
+			return nil, err
+		}
+		return getOperations(release), nil
+	}),
+	"operation.wait": withParams(func(ctx context.Context, params operationParams) (any, error) {
+		operation, err := findOperation(params.Id)
+		if err != nil {
+			return nil, invalidParams("%s", err)
+		}
+		return operation.wait(ctx)
+	}),
+	"operation.cancel": withParams(func(ctx context.Context, params operationParams) (any, error) {
+		if err := cancelOperation(params.Id); err != nil {
+			return nil, invalidParams("%s", err)
+		}
+		return nil, nil
+	}),
+
+	"addon.list": func(context.Context, jsontext.Value) (any, error) {
+		return getAddonsState().Addons, nil
+	},
+}
+
+func addonResult(err error) (any, error) {
+	if err != nil {
+		return nil, &rpcError{Code: codeProcessFailed, Message: err.Error()}
+	}
+	return getAddonsState().Addons, nil
+}
+
+// `call` calls `name` with `params`, which are encoded as they'd
+// have been sent by a client
+func call(ctx context.Context, name string, params any) (any, error) {
+	method, exists := methods[name]
+	if !exists {
+		return nil, &rpcError{Code: codeMethodNotFound, Message: "method not found: " + name}
+	}
+
+	var raw jsontext.Value
+	if params != nil {
+		var err error
+		if raw, err = json.Marshal(params); err != nil {
+			return nil, &rpcError{Code: codeInternalError, Message: err.Error()}
+		}
+	}
+	return method(ctx, raw)
+}
+
+// `handleRequest` handles a single JSON-RPC request, returning the
+// response to send, if any
+func handleRequest(ctx context.Context, data []byte) []byte {
+	var request rpcRequest
+	if err := json.Unmarshal(data, &request); err != nil {
+		return encodeResponse(rpcResponse{Id: jsontext.Value("null"), Error: &rpcError{Code: codeParseError, Message: err.Error()}})
+	}
+
+	// parameters aren't logged, as they may contain the GitHub token
+	log.Printf("Request received: %s (id %s)\n", request.Method, request.Id)
+
+	response := rpcResponse{Id: request.Id}
+	if len(request.Id) == 0 {
+		response.Id = jsontext.Value("null")
+	}
+
+	if request.JsonRpc != "2.0" || request.Method == "" {
+		response.Error = &rpcError{Code: codeInvalidRequest, Message: "not a JSON-RPC 2.0 request"}
+		return encodeResponse(response)
+	}
+
+	method, exists := methods[request.Method]
+	if !exists {
+		response.Error = &rpcError{Code: codeMethodNotFound, Message: "method not found: " + request.Method}
+	} else if result, err := method(ctx, request.Params); err != nil {
+		var rpcErr *rpcError
+		if !errors.As(err, &rpcErr) {
+			rpcErr = &rpcError{Code: codeInternalError, Message: err.Error()}
+		}
+		response.Error = rpcErr
+	} else if response.Result, err = json.Marshal(result, json.OmitZeroStructFields(true)); err != nil {
+		response.Error = &rpcError{Code: codeInternalError, Message: err.Error()}
+	}
+
+	// notifications aren't answered
+	if len(request.Id) == 0 {
+		return nil
+	}
+	return encodeResponse(response)
+}
+
+func encodeResponse(response rpcResponse) []byte {
+	response.JsonRpc = "2.0"
+	buffer, err := json.Marshal(response, json.OmitZeroStructFields(true))
+	if err != nil {
+		// can't happen, as everything in the response has already been encoded
+		panic(err)
+	}
+	return append(buffer, '\n')
+}
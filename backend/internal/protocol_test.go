@@ -0,0 +1,227 @@
+package dislaunch
+
+import (
+	"bufio"
+	"context"
+	"encoding/json/jsontext"
+	"encoding/json/v2"
+	"errors"
+	"net"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Fohqul/dislaunch/client"
+)
+
+// `fill` sets everything exported in `value` that's encoded to
+// something other than its zero value, so that every member ends up
+// in the encoding
+func fill(value reflect.Value) {
+	switch value.Kind() {
+	case reflect.Pointer:
+		value.Set(reflect.New(value.Type().Elem()))
+		fill(value.Elem())
+	case reflect.Struct:
+		if value.Type() == reflect.TypeFor[time.Time]() {
+			value.Set(reflect.ValueOf(time.Date(2026, time.January, 2, 3, 4, 5, 0, time.UTC)))
+			return
+		}
+		for i := range value.NumField() {
+			if value.Type().Field(i).IsExported() {
+				fill(value.Field(i))
+			}
+		}
+	case reflect.Slice:
+		if value.Type() == reflect.TypeFor[jsontext.Value]() {
+			value.SetBytes([]byte(`"value"`))
+			return
+		}
+		slice := reflect.MakeSlice(value.Type(), 1, 1)
+		fill(slice.Index(0))
+		value.Set(slice)
+	case reflect.Map:
+		key, element := reflect.New(value.Type().Key()).Elem(), reflect.New(value.Type().Elem()).Elem()
+		fill(key)
+		fill(element)
+		value.Set(reflect.MakeMap(value.Type()))
+		value.SetMapIndex(key, element)
+	case reflect.String:
+		value.SetString("value")
+	case reflect.Bool:
+		value.SetBool(true)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		value.SetInt(1)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		value.SetUint(1)
+	case reflect.Float32, reflect.Float64:
+		value.SetFloat(1)
+	}
+}
+
+// `roundTrip` encodes `from` filled as the daemon encodes the state and
+// decodes it into `to`, failing on any member that `to` doesn't have
+func roundTrip[From any, To any](t *testing.T) {
+	t.Helper()
+
+	var from From
+	fill(reflect.ValueOf(&from).Elem())
+	buffer, err := json.Marshal(from, json.OmitZeroStructFields(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var to To
+	if err = json.Unmarshal(buffer, &to, json.RejectUnknownMembers(true)); err != nil {
+		t.Errorf("error decoding %T as %T: %s", from, to, err)
+	}
+}
+
+func TestClientDecodesState(t *testing.T) {
+	roundTrip[backendState, client.State](t)
+	// and the other way round, so that nothing the client expects
+	// has been dropped from the daemon
+	roundTrip[client.State, backendState](t)
+}
+
+// `dialDaemon` connects a client to a socket answered by the daemon's
+// own request handling
+func dialDaemon(t *testing.T) *client.Client {
+	t.Helper()
+
+	socket := filepath.Join(t.TempDir(), "dislaunch.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		listener.Close()
+	})
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		reader := bufio.NewReader(conn)
+		for {
+			line, err := reader.ReadBytes('\n')
+			if err != nil {
+				return
+			}
+			if _, err = conn.Write(handleRequest(context.Background(), line)); err != nil {
+				return
+			}
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	dialed, err := client.Dial(ctx, socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		dialed.Close()
+	})
+	return dialed
+}
+
+// Each method is called with parameters that the daemon decodes but
+// then rejects, so that nothing is changed by the test. Parameters the
+// daemon can't decode, or methods it doesn't have, fail the test.
+func TestDaemonAcceptsClientParams(t *testing.T) {
+	dialed := dialDaemon(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	const release = "nonexistent"
+	value, rate := "value", -1
+	enabled := true
+	subscription := client.Subscription{Releases: []string{release}, Kinds: []string{"progress"}}
+
+	calls := map[string]func() error{
+		"CheckForUpdates": func() error { return dialed.CheckForUpdates(ctx, release) },
+		"Install":         func() error { return dialed.Install(ctx, release) },
+		"Uninstall": func() error {
+			_, err := dialed.Uninstall(ctx, release, client.UninstallOptions{Trash: true, DryRun: true, Purge: []string{"cache"}})
+			return err
+		},
+		"Move":         func() error { return dialed.Move(ctx, release, "path") },
+		"Cancel":       func() error { return dialed.Cancel(ctx, release) },
+		"ApplyBd":      func() error { return dialed.ApplyBd(ctx, release, true) },
+		"SetBdEnabled": func() error { return dialed.SetBdEnabled(ctx, release, true) },
+		"SetBdChannel": func() error { return dialed.SetBdChannel(ctx, release, "stable") },
+		"BdChangelog": func() error {
+			_, err := dialed.BdChangelog(ctx, release)
+			return err
+		},
+		"PinBd":                   func() error { return dialed.PinBd(ctx, release, "v1.0.0") },
+		"UnpinBd":                 func() error { return dialed.UnpinBd(ctx, release) },
+		"SetInjector":             func() error { return dialed.SetInjector(ctx, release, "injector") },
+		"SetOpenAsar":             func() error { return dialed.SetOpenAsar(ctx, release, true) },
+		"SetAutostart":            func() error { return dialed.SetAutostart(ctx, release, true) },
+		"SetAutostartMinimized":   func() error { return dialed.SetAutostartMinimized(ctx, release, true) },
+		"SetCommandLineArguments": func() error { return dialed.SetCommandLineArguments(ctx, release, []string{"--argument"}) },
+		"SetEnvironment":          func() error { return dialed.SetEnvironment(ctx, release, "NAME", &value) },
+		"SetWrapper":              func() error { return dialed.SetWrapper(ctx, release, []string{"wrapper"}) },
+		"Inspect": func() error {
+			_, err := dialed.Inspect(ctx, release, "path")
+			return err
+		},
+		"Start": func() error {
+			_, err := dialed.Start(ctx, release, "bd_apply", map[string]bool{"force": true})
+			return err
+		},
+		"Operations": func() error {
+			_, err := dialed.Operations(ctx, release)
+			return err
+		},
+		"Wait": func() error {
+			_, err := dialed.Wait(ctx, 0)
+			return err
+		},
+		"CancelOperation": func() error { return dialed.CancelOperation(ctx, 0) },
+		"SetConfiguration": func() error {
+			return dialed.SetConfiguration(ctx, client.ConfigurationUpdate{
+				AutomaticallyCheckForUpdates: &enabled,
+				NotifyOnUpdateAvailable:      &enabled,
+				AutomaticallyInstallUpdates:  &enabled,
+				DefaultInstallPath:           &value,
+				GithubToken:                  &value,
+				MaxBroadcastRate:             &rate,
+			})
+		},
+		"InstallAddon": func() error {
+			_, err := dialed.InstallAddon(ctx, "nonexistent", "source")
+			return err
+		},
+		"RemoveAddon": func() error {
+			_, err := dialed.RemoveAddon(ctx, "")
+			return err
+		},
+		"Subscribe": func() error {
+			_, err := dialed.Subscribe(ctx, subscription)
+			return err
+		},
+		"Unsubscribe": func() error {
+			_, err := dialed.Unsubscribe(ctx, subscription)
+			return err
+		},
+	}
+
+	for name, call := range calls {
+		var rpcErr *client.Error
+		err := call()
+		if !errors.As(err, &rpcErr) {
+			t.Errorf("%s returned %v, want the daemon to reject its parameters", name, err)
+			continue
+		}
+		if rpcErr.Code == codeMethodNotFound || strings.HasPrefix(rpcErr.Message, "invalid params:") {
+			t.Errorf("%s: %s", name, rpcErr.Message)
+		}
+	}
+}
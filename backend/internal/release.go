@@ -11,17 +11,16 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"strings"
 	"sync"
 	"sync/atomic"
-	"syscall"
 	"time"
 
 	"github.com/gofrs/flock"
 	"github.com/google/go-github/github"
 	"github.com/mholt/archives"
-	cp "github.com/otiai10/copy"
 	"github.com/shirou/gopsutil/process"
 )
 
@@ -82,6 +81,7 @@ const (
 	statusBdInjection status = "bd_injection"
 	statusMove        status = "move"
 	statusUninstall   status = "uninstall"
+	statusOpenAsar    status = "open_asar"
 	// A fatal status indicates that, when a release is installed, something has gone seriously wrong and
 	// the application has reached a state it never should have. Processes should return immediately when
 	// the state becomes fatal so as to prevent further damage being done or further errors occurring.
@@ -96,14 +96,37 @@ const (
 )
 
 type releaseInternal struct {
-	InstallPath          string    `json:"install_path"`
-	LastChecked          time.Time `json:"last_checked"`
-	LatestVersion        string    `json:"latest_version"`
-	CommandLineArguments string    `json:"command_line_arguments"`
-	BdEnabled            bool      `json:"bd_enabled"`
-	BdChannel            bdChannel `json:"bd_channel"`
-	BdInstalledRelease   *int64    `json:"bd_installed_release"`
-	BdLatestRelease      *int64    `json:"bd_latest_release"`
+	InstallPath   string    `json:"install_path"`
+	LastChecked   time.Time `json:"last_checked"`
+	LatestVersion string    `json:"latest_version"`
+	// Command-line arguments used to be stored as a single
+	// unparsed string. It's only kept so that older gobs can
+	// still be decoded, and is migrated to `Arguments` by
+	// `getInternal`.
+	CommandLineArguments string            `json:"-"`
+	Arguments            []string          `json:"command_line_arguments"`
+	Environment          map[string]string `json:"environment"`
+	Wrapper              []string          `json:"wrapper"`
+	// Although these are prefixed with "Bd", as BetterDiscord used
+	// to be the only client mod, they apply to whichever client mod
+	// `Injector` is
+	BdEnabled          bool      `json:"bd_enabled"`
+	BdChannel          bdChannel `json:"bd_channel"`
+	BdInstalledRelease *int64    `json:"bd_installed_release"`
+	BdLatestRelease    *int64    `json:"bd_latest_release"`
+	// Descriptions of `BdInstalledRelease` and `BdLatestRelease`
+	BdInstalled *bdRelease `json:"bd_installed"`
+	BdLatest    *bdRelease `json:"bd_latest"`
+	// When set, `BdLatestRelease` is always the release with this
+	// tag, regardless of `BdChannel`
+	BdPin    string `json:"bd_pin"`
+	Injector string `json:"injector"`
+	// The injector `BdInstalledRelease` belongs to, so it can be
+	// removed after switching to another
+	InstalledInjector  string `json:"installed_injector"`
+	OpenAsar           bool   `json:"open_asar"`
+	Autostart          bool   `json:"autostart"`
+	AutostartMinimized bool   `json:"autostart_minimized"`
 }
 
 // A "process" is essentially a method of `release` which is
@@ -117,14 +140,33 @@ type release struct {
 	gobPath              string
 	desktopEntryFileName string
 
-	mu       sync.Mutex
+	mu        sync.Mutex
+	operation *operation // the running operation, if any
+	// Flushing happens for every chunk downloaded or extracted, so
+	// it uses the last internal data read or written and the version
+	// read as of the last process rather than reading them each time
+	internal      *releaseInternal
+	version       string
+	versionOf     string // the install path `version` was read from
+	versionCached bool
+	// `queue` is guarded by its own lock, so that operations can
+	// be queued whilst a process holds `mu`
+	queueMu  sync.Mutex
+	queue    []*operation // operations yet to start, in order
+	working  bool         // whether a goroutine is running the queue
 	ctx      context.Context
 	cancel   atomic.Value
 	status   status // currently active process
 	message  string
 	progress uint8 // indeterminate progress when 101
 	err      error
-	state    atomic.Value
+	removals []removal // what the last uninstall removed
+	// the result of the last `inspect`
+	inspection *inspection
+	// set when the watcher last had to reinject the client mod
+	lastReinjection   time.Time
+	reinjectionReason string
+	state             atomic.Value
 }
 
 type releaseState struct {
@@ -133,6 +175,16 @@ type releaseState struct {
 	Progress uint8  `json:"progress"`
 	Error    string `json:"error"`
 
+	Removals  []removal            `json:"removals"`
+	Reclaimed map[purgeScope]int64 `json:"reclaimed"` // total size of `Removals` for each scope
+
+	Inspection *inspection `json:"inspection"`
+
+	LastReinjection   time.Time `json:"last_reinjection"`
+	ReinjectionReason string    `json:"reinjection_reason"`
+
+	Queue []operation `json:"queue"` // operations waiting on the active process
+
 	Internal *releaseInternal `json:"internal"`
 	Version  string           `json:"version"`
 }
@@ -182,6 +234,22 @@ func (release *release) String() string {
 	return release.id
 }
 
+func (release *release) desktopEntryPath() string {
+	return filepath.Join(getHomeXdgDirectory("XDG_DATA_HOME", filepath.Join(".local", "share")), "applications", release.desktopEntryFileName)
+}
+
+// Both the desktop entry and the autostart entry launch
+// Discord through `dislaunch` so that updates are installed
+// before Discord itself is executed
+func (release *release) launcherExec() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("error getting home directory: %w", err)
+	}
+
+	return "Exec=" + filepath.Join(home, ".local", "bin", "dislaunch") + " " + release.id, nil
+}
+
 // Any errors in dealing with internal release data
 // (e.g. opening the gob, encoding/decoding) are always
 // considered fatal. So that their callers don't all need
@@ -221,13 +289,30 @@ func (release *release) getInternal() (releaseInternal, error) {
 	var internal releaseInternal
 	if err := gob.NewDecoder(file).Decode(&internal); err != nil {
 		if err == io.EOF {
-			return releaseInternal{BdChannel: bdStable}, nil
+			internal = releaseInternal{BdChannel: bdStable}
+			release.internal = &internal
+			return internal, nil
 		}
 
 		release.status = statusFatal
 		release.err = fmt.Errorf("error decoding internal data for release '%s': %w", release, err)
 		return releaseInternal{}, release.err
 	}
+
+	if internal.CommandLineArguments != "" {
+		arguments, err := splitArguments(internal.CommandLineArguments)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error parsing legacy command-line arguments '%s' - splitting by whitespace instead: %s\n", internal.CommandLineArguments, err)
+			arguments = strings.Fields(internal.CommandLineArguments)
+		}
+		if internal.Arguments == nil {
+			internal.Arguments = arguments
+		}
+		internal.CommandLineArguments = ""
+	}
+
+	cached := internal
+	release.internal = &cached
 	return internal, nil
 }
 
@@ -250,9 +335,28 @@ func (release *release) setInternal(internal *releaseInternal) error {
 		release.flush(nil, true)
 		return release.err
 	}
+
+	cached := *internal
+	release.internal = &cached
 	return nil
 }
 
+// `getCachedVersion` is `getVersion`, but only reads the version
+// again once the install path has changed or a process has finished
+func (release *release) getCachedVersion(internal *releaseInternal) string {
+	if release.versionCached && release.versionOf == internal.InstallPath {
+		return release.version
+	}
+
+	release.version = ""
+	if version, err := release.getVersion(internal); err == nil {
+		release.version = version
+	}
+	release.versionOf = internal.InstallPath
+	release.versionCached = true
+	return release.version
+}
+
 /**
  * Since Discord installs expose their version in `resources/build_info.json`,
  * we can always just read from there to get the installed version without the
@@ -285,23 +389,46 @@ func (release *release) getVersion(internal *releaseInternal) (string, error) {
 	return buildInfo.Version, nil
 }
 
-func (release *release) takeOver() (*releaseInternal, func()) {
+// `takeOver` waits for any active process to finish before starting
+// another. The returned `reset` must be deferred by the process, and
+// returns the error the process finished with so that it can be
+// returned in turn.
+func (release *release) takeOver() (*releaseInternal, func() error, error) {
 	release.mu.Lock()
 
 	if release.status == statusFatal {
-		return nil, nil
+		err := release.err
+		release.mu.Unlock()
+		if err == nil {
+			err = fmt.Errorf("release '%s' is in a fatal state", release)
+		}
+		return nil, nil, err
 	}
 
-	if internal, err := release.getInternal(); err == nil {
-		return &internal, func() {
-			release.setInternal(&internal)
-			release.flush(&internal, true)
-			release.reset(&internal, true)
+	// processes are cancelled through their operation
+	if release.operation != nil {
+		if err := release.operation.ctx.Err(); err != nil {
 			release.mu.Unlock()
+			return nil, nil, err
 		}
+		release.ctx = release.operation.ctx
+		release.cancel.Store(release.operation.cancel)
 	}
 
-	return nil, nil
+	internal, err := release.getInternal()
+	if err != nil {
+		release.mu.Unlock()
+		return nil, nil, err
+	}
+
+	return &internal, func() error {
+		release.setInternal(&internal)
+		release.flush(&internal, true)
+		err := release.err
+		release.reset(&internal, true)
+		release.mu.Unlock()
+		return err
+	}, nil
 }
 
 func (release *release) flush(internal *releaseInternal, broadcast bool) {
@@ -309,25 +436,50 @@ func (release *release) flush(internal *releaseInternal, broadcast bool) {
 		Status:   release.status,
 		Message:  release.message,
 		Progress: release.progress,
+		Removals: release.removals,
+
+		Inspection: release.inspection,
+
+		LastReinjection:   release.lastReinjection,
+		ReinjectionReason: release.reinjectionReason,
+	}
+
+	for _, removal := range release.removals {
+		if state.Reclaimed == nil {
+			state.Reclaimed = make(map[purgeScope]int64)
+		}
+		state.Reclaimed[removal.Scope] += removal.Size
 	}
 
 	if release.err != nil {
 		state.Error = release.err.Error()
 	}
 
+	if internal == nil {
+		internal = release.internal
+	}
+	if internal == nil {
+		if loaded, err := release.getInternal(); err == nil {
+			internal = &loaded
+		}
+	}
+
 	if internal != nil {
-		state.Internal = internal
-	} else if internal, err := release.getInternal(); err == nil {
-		state.Internal = &internal
+		// a copy, as the process carries on changing its own
+		copied := *internal
+		state.Internal = &copied
+		state.Version = release.getCachedVersion(&copied)
 	}
 
-	if state.Internal != nil {
-		if version, err := release.getVersion(state.Internal); err == nil {
-			state.Version = version
-		}
+	if release.operation != nil && release.status != statusNone {
+		release.operation.update(release.message, release.progress)
 	}
 
+	// the queue changes without `mu`, so stored alongside it under `queueMu` to not overwrite a newer queue
+	release.queueMu.Lock()
+	state.Queue = release.getQueue()
 	release.state.Store(state)
+	release.queueMu.Unlock()
 	if broadcast {
 		broadcastBackendState()
 	}
@@ -342,6 +494,7 @@ func (release *release) reset(internal *releaseInternal, broadcast bool) {
 	release.message = ""
 	release.progress = 0
 	release.err = nil
+	release.versionCached = false // e.g. once installed
 
 	ctx, cancel := context.WithCancel(context.Background())
 	release.ctx = ctx
@@ -377,22 +530,78 @@ func (release *release) getState() *releaseState {
 	return state
 }
 
-func (release *release) setCommandLineArguments(commandLineArguments string) {
-	internal, reset := release.takeOver()
-	if internal == nil || reset == nil {
-		return
+func (release *release) setCommandLineArguments(arguments []string) (result error) {
+	internal, reset, err := release.takeOver()
+	if err != nil {
+		return err
 	}
-	defer reset()
+	defer func() {
+		result = reset()
+	}()
 
-	internal.CommandLineArguments = commandLineArguments
+	internal.Arguments = arguments
+	return
 }
 
-func (release *release) setBdEnabled(bdEnabled bool) {
-	internal, reset := release.takeOver()
-	if internal == nil || reset == nil {
+// Setting a variable to `nil` unsets it
+func (release *release) setEnvironment(name string, value *string) (result error) {
+	internal, reset, err := release.takeOver()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		result = reset()
+	}()
+
+	if err := validateEnvironmentName(name); err != nil {
+		release.err = err
 		return
 	}
-	defer reset()
+
+	if value == nil {
+		delete(internal.Environment, name)
+		return
+	}
+
+	if strings.IndexByte(*value, 0) >= 0 {
+		release.err = fmt.Errorf("value of environment variable '%s' cannot contain NUL", name)
+		return
+	}
+	if internal.Environment == nil {
+		internal.Environment = make(map[string]string)
+	}
+	internal.Environment[name] = *value
+	return
+}
+
+func (release *release) setWrapper(wrapper []string) (result error) {
+	internal, reset, err := release.takeOver()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		result = reset()
+	}()
+
+	if len(wrapper) > 0 {
+		if _, err := exec.LookPath(wrapper[0]); err != nil {
+			release.err = fmt.Errorf("error finding wrapper command '%s': %w", wrapper[0], err)
+			return
+		}
+	}
+
+	internal.Wrapper = wrapper
+	return
+}
+
+func (release *release) setBdEnabled(bdEnabled bool) (result error) {
+	internal, reset, err := release.takeOver()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		result = reset()
+	}()
 
 	internal.BdEnabled = bdEnabled
 	if release.setInternal(internal) != nil {
@@ -400,14 +609,17 @@ func (release *release) setBdEnabled(bdEnabled bool) {
 	}
 
 	release.checkForBdUpdates(internal)
+	return
 }
 
-func (release *release) setBdChannel(bdChannel bdChannel) {
-	internal, reset := release.takeOver()
-	if internal == nil || reset == nil {
-		return
+func (release *release) setBdChannel(bdChannel bdChannel) (result error) {
+	internal, reset, err := release.takeOver()
+	if err != nil {
+		return err
 	}
-	defer reset()
+	defer func() {
+		result = reset()
+	}()
 
 	internal.BdChannel = bdChannel
 	if release.setInternal(internal) != nil {
@@ -415,14 +627,92 @@ func (release *release) setBdChannel(bdChannel bdChannel) {
 	}
 
 	release.checkForBdUpdates(internal)
+	return
 }
 
-func (release *release) checkForUpdates() {
-	internal, reset := release.takeOver()
-	if internal == nil || reset == nil {
+// `setBdPin` pins the client mod to the release tagged `tag`, which
+// is resolved first so that a nonexistent tag is rejected
+func (release *release) setBdPin(tag string) (result error) {
+	internal, reset, err := release.takeOver()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		result = reset()
+	}()
+
+	injector, err := getInjector(internal.Injector)
+	if err != nil {
+		release.err = err
 		return
 	}
-	defer reset()
+
+	pinned, err := injector.fetchTag(release.ctx, getGithubClient(), tag)
+	if err != nil {
+		release.err = err
+		return
+	}
+
+	internal.BdPin = tag
+	internal.BdLatestRelease = pinned.ID
+	internal.BdLatest = describeBdRelease(injector, pinned)
+	release.setInternal(internal)
+	return
+}
+
+func (release *release) unpinBd() (result error) {
+	internal, reset, err := release.takeOver()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		result = reset()
+	}()
+
+	internal.BdPin = ""
+	if release.setInternal(internal) != nil {
+		return
+	}
+
+	release.checkForBdUpdates(internal)
+	return
+}
+
+func (release *release) setInjector(id string) (result error) {
+	internal, reset, err := release.takeOver()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		result = reset()
+	}()
+
+	if _, err := getInjector(id); err != nil {
+		release.err = err
+		return
+	}
+
+	// the latest release and pinned tag belong to the previous injector
+	internal.Injector = id
+	internal.BdLatestRelease = nil
+	internal.BdLatest = nil
+	internal.BdPin = ""
+	if release.setInternal(internal) != nil {
+		return
+	}
+
+	release.checkForBdUpdates(internal)
+	return
+}
+
+func (release *release) checkForUpdates() (result error) {
+	internal, reset, err := release.takeOver()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		result = reset()
+	}()
 
 	release.status = statusUpdateCheck
 	release.message = "Checking for updates"
@@ -448,19 +738,24 @@ func (release *release) checkForUpdates() {
 	internal.LastChecked = time.Now()
 
 	release.checkForBdUpdates(internal)
+	return
 }
 
-func (release *release) install() {
-	internal, reset := release.takeOver()
-	if internal == nil || reset == nil {
-		return
+func (release *release) install() (result error) {
+	internal, reset, err := release.takeOver()
+	if err != nil {
+		return err
 	}
-	defer reset()
+	defer func() {
+		result = reset()
+	}()
 
 	// even if installing Discord fails for whatever reason,
 	// BetterDiscord should still be updated
 	defer func() {
-		go release.applyBd()
+		release.start("bd_apply", bdApplyParams{releaseParams: releaseParams{Release: release.id}}, processResult(func() error {
+			return release.applyBd(false)
+		}))
 	}()
 
 	installed := internal.InstallPath != ""
@@ -679,22 +974,26 @@ func (release *release) install() {
 		internal.InstallPath = installPath
 	}
 
+	// extracting has replaced OpenAsar with Discord's own `app.asar`
+	if err = release.applyOpenAsar(internal, true); err != nil {
+		release.err = err
+		release.flush(internal, true)
+	}
+
 	if desktopEntry.Len() == 0 {
 		release.err = fmt.Errorf("error finding desktop file")
 		return
 	}
 
-	home, err := os.UserHomeDir()
+	oldExec := "Exec=" + filepath.Join("/", "usr", "share", release.desktopEntryFileName[:strings.IndexByte(release.desktopEntryFileName, '.')], release.pathName)
+	newExec, err := release.launcherExec()
 	if err != nil {
-		release.err = fmt.Errorf("error getting home directory: %w", err)
+		release.err = err
 		return
 	}
-
-	oldExec := "Exec=" + filepath.Join("/", "usr", "share", release.desktopEntryFileName[:strings.IndexByte(release.desktopEntryFileName, '.')], release.pathName)
-	newExec := "Exec=" + filepath.Join(home, ".local", "bin", "dislaunch") + " " + release.id
 	dislaunchDesktopEntry := strings.ReplaceAll(desktopEntry.String(), oldExec, newExec)
 
-	dislaunchDesktopEntryFile, err := os.OpenFile(filepath.Join(getHomeXdgDirectory("XDG_DATA_HOME", filepath.Join(".local", "share")), "applications", release.desktopEntryFileName), os.O_CREATE|os.O_WRONLY, 0644)
+	dislaunchDesktopEntryFile, err := os.OpenFile(release.desktopEntryPath(), os.O_CREATE|os.O_WRONLY, 0644)
 	if err != nil {
 		release.err = fmt.Errorf("error opening .desktop file: %w", err)
 		return
@@ -713,144 +1012,166 @@ func (release *release) install() {
 		release.progress = uint8(float64(accumulated) / float64(len(dislaunchDesktopEntry)) * 100)
 		release.flush(internal, true)
 	}
+
+	// the autostart entry is derived from the desktop entry, so it must be rewritten too
+	if err = release.writeAutostartEntry(internal); err != nil {
+		release.err = err
+	}
+	return
 }
 
-func (release *release) move(path string) {
-	internal, reset := release.takeOver()
-	if internal == nil || reset == nil {
-		return
+func (release *release) checkForBdUpdates(internal *releaseInternal) error {
+	if !internal.BdEnabled {
+		return nil
 	}
-	defer reset()
 
-	if internal.InstallPath == "" {
-		return
+	injector, err := getInjector(internal.Injector)
+	if err != nil {
+		release.err = err
+		return err
 	}
 
-	oldPath := filepath.Join(internal.InstallPath, release.pathName)
-	newPath := filepath.Join(path, release.pathName)
+	var latest *github.RepositoryRelease
+	if internal.BdPin != "" {
+		latest, err = injector.fetchTag(release.ctx, getGithubClient(), internal.BdPin)
+	} else {
+		latest, err = injector.fetchLatest(release.ctx, getGithubClient(), internal.BdChannel)
+	}
+	if err != nil {
+		release.err = err
+		return err
+	}
+	internal.BdLatestRelease = latest.ID
+	internal.BdLatest = describeBdRelease(injector, latest)
 
-	release.status = statusMove
-	release.message = "Moving to " + newPath
+	return release.setInternal(internal)
+}
+
+// `getBdChangelog` describes the installed and latest client mod
+// releases and collects those after the installed one, up to and
+// including the latest. Prereleases are only included when the
+// latest release is one itself.
+func (release *release) getBdChangelog() (changelog *bdChangelog, result error) {
+	internal, reset, err := release.takeOver()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		result = reset()
+		if result != nil {
+			changelog = nil
+		}
+	}()
+
+	release.status = statusUpdateCheck
 	release.progress = 101
 	release.flush(internal, true)
 
-	err := os.Rename(oldPath, newPath)
-	if err == nil {
-		internal.InstallPath = path
+	if internal.BdLatestRelease == nil && release.checkForBdUpdates(internal) != nil {
+		return
+	}
+	if internal.BdLatestRelease == nil {
+		release.err = errors.New("no client mod release to get the changelog of")
 		return
 	}
 
-	if err.(*os.LinkError).Err.(syscall.Errno) != syscall.EXDEV {
-		release.err = fmt.Errorf("error moving release '%s' to '%s': %w", release, path, err)
+	injector, err := getInjector(internal.Injector)
+	if err != nil {
+		release.err = err
 		return
 	}
 
-	if err = cp.Copy(oldPath, newPath, cp.Options{
-		Sync:          true,
-		PreserveTimes: true,
-		PreserveOwner: true,
-		// HACK: Because we need to report status to the frontend,
-		// we need to run a callback for each file/directory.
-		// The closest this package gives us is this `Skip`
-		// callback which obviously isn't meant for this,
-		// but if it works, it works.
-		Skip: func(_ os.FileInfo, _ string, dest string) (bool, error) {
-			select {
-			case <-release.ctx.Done():
-				return true, release.ctx.Err()
-			default:
-			}
-			release.message = "Copying to " + dest
-			release.flush(internal, true)
-			return false, nil
-		},
-	}); err != nil {
-		release.err = fmt.Errorf("error copying release '%s' to '%s': %w", release, path, err)
-		release.flush(internal, true)
-		if err := os.RemoveAll(newPath); err != nil {
-			release.err = fmt.Errorf("error cleaning up new path: %w", err)
+	release.message = "Getting " + injector.name() + " changelog"
+	release.flush(internal, true)
+
+	// looked up by ID rather than found in the list, as a pinned
+	// latest release may be older than the installed one
+	client := getGithubClient()
+	describe := func(id *int64, description **bdRelease) error {
+		if id == nil || *description != nil && (*description).Id == *id {
+			return nil
+		}
+		fetched, err := injector.fetchId(release.ctx, client, *id)
+		if err != nil {
+			return err
 		}
+		*description = describeBdRelease(injector, fetched)
+		return nil
+	}
+	changelog = &bdChangelog{Installed: internal.BdInstalled, Latest: internal.BdLatest}
+	if err = describe(internal.BdInstalledRelease, &changelog.Installed); err != nil {
+		release.err = err
 		return
 	}
-
-	if err = os.RemoveAll(oldPath); err != nil {
-		release.err = fmt.Errorf("error removing previous install path '%s': %w", oldPath, err)
-		release.flush(internal, true)
+	if err = describe(internal.BdLatestRelease, &changelog.Latest); err != nil {
+		release.err = err
+		return
 	}
-
-	internal.InstallPath = path
-}
-
-func (release *release) uninstall() {
-	internal, reset := release.takeOver()
-	if internal == nil || reset == nil {
+	if internal.BdInstalledRelease == nil {
+		// without anything installed, there's nothing to compare against
+		changelog.Releases = []*bdRelease{changelog.Latest}
 		return
 	}
-	defer reset()
-
-	if internal.InstallPath == "" {
+	if !changelog.Latest.PublishedAt.After(changelog.Installed.PublishedAt) {
 		return
 	}
 
-	path := filepath.Join(internal.InstallPath, release.pathName)
-
-	release.status = statusUninstall
-	release.message = "Deleting " + path
-	release.progress = 101
-	release.flush(internal, true)
+	collecting := false
+	for page := 1; page != 0; {
+		releases, response, err := injector.list(release.ctx, client, page)
+		if err != nil {
+			release.err = err
+			return
+		}
 
-	// Scary!
-	// todo perhaps consider some safeguards to prevent deleting critical directories?
-	if err := os.RemoveAll(path); err != nil {
-		release.status = statusFatal
-		release.err = fmt.Errorf("error uninstalling release '%s' from '%s': %w", release, internal.InstallPath, err)
-		release.flush(internal, true)
-	}
+		for _, bdRelease := range releases {
+			if bdRelease.GetID() == changelog.Installed.Id || !bdRelease.GetPublishedAt().After(changelog.Installed.PublishedAt) {
+				page = 0
+				break
+			}
+			if bdRelease.GetID() == changelog.Latest.Id {
+				collecting = true
+			}
+			if collecting && (changelog.Latest.Prerelease || !bdRelease.GetPrerelease()) {
+				changelog.Releases = append(changelog.Releases, describeBdRelease(injector, bdRelease))
+			}
+		}
 
-	if err := os.Remove(filepath.Join(getHomeXdgDirectory("XDG_DATA_HOME", filepath.Join(".local", "share")), "applications", release.desktopEntryFileName)); err != nil {
-		release.status = statusFatal
-		release.err = fmt.Errorf("error deleting desktop entry for release '%s': %w", release, err)
-		release.flush(internal, true)
+		if page != 0 {
+			page = response.NextPage
+		}
 	}
+	return
 }
 
-func (release *release) checkForBdUpdates(internal *releaseInternal) error {
-	if !internal.BdEnabled {
-		return nil
+// Discord keeps its modules in its user data directory, which is
+// the lowercase form of its path name, under its host version
+func (release *release) getCoreModulePath(version string) (string, error) {
+	// no need to `os.MkdirAll` here, I already do it later
+	config, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("error getting user config directory: %w", err)
 	}
 
-	client := github.NewClient(nil)
+	return filepath.Join(config, strings.ToLower(release.pathName), version, "modules", "discord_desktop_core"), nil
+}
 
-	switch internal.BdChannel {
-	case bdStable:
-		bdRelease, _, err := client.Repositories.GetLatestRelease(release.ctx, "BetterDiscord", "BetterDiscord")
-		if err != nil {
-			release.err = fmt.Errorf("error getting latest BetterDiscord release: %w", err)
-			return err
-		}
-		internal.BdLatestRelease = bdRelease.ID
-	case bdCanary:
-		releases, _, err := client.Repositories.ListReleases(release.ctx, "BetterDiscord", "BetterDiscord", &github.ListOptions{Page: 1, PerPage: 1})
-		if err != nil {
-			release.err = fmt.Errorf("error getting BetterDiscord releases: %w", err)
-			return err
-		}
-		internal.BdLatestRelease = releases[0].ID
-	default:
-		release.err = fmt.Errorf("invalid BetterDiscord release channel: %s", internal.BdChannel)
-		return release.err
+// `force` overwrites `index.js` even if something else has modified it
+func (release *release) applyBd(force bool) (result error) {
+	internal, reset, err := release.takeOver()
+	if err != nil {
+		return err
 	}
+	defer func() {
+		result = reset()
+	}()
 
-	return release.setInternal(internal)
+	release.injectBd(internal, force)
+	return
 }
 
-func (release *release) applyBd() {
-	internal, reset := release.takeOver()
-	if internal == nil || reset == nil {
-		return
-	}
-	defer reset()
-
+// `injectBd` is `applyBd` for callers which already hold the lock
+func (release *release) injectBd(internal *releaseInternal, force bool) {
 	release.status = statusBdInjection
 	release.flush(internal, true)
 
@@ -861,61 +1182,69 @@ func (release *release) applyBd() {
 
 	release.status = statusBdInjection
 
-	// no need to `os.MkdirAll` here, I already do it later
-	config, err := os.UserConfigDir()
+	path, err := release.getCoreModulePath(version)
 	if err != nil {
-		release.err = fmt.Errorf("error getting user config directory: %w", err)
+		release.err = err
 		return
 	}
 
-	path := filepath.Join(config, strings.ToLower(release.pathName), version, "modules", "discord_desktop_core")
+	injector, err := getInjector(internal.Injector)
+	if err != nil {
+		release.err = err
+		return
+	}
 
+	// Discord downloads its modules on first launch, and the shim would
+	// only fail to load a corrupt one. Checked before anything is
+	// downloaded, so that the client mod isn't put in (and recorded as
+	// installed into) a `discord_desktop_core` Discord hasn't created.
 	if internal.BdEnabled {
-		if internal.BdLatestRelease == nil && release.checkForBdUpdates(internal) != nil {
+		if err = validateAsar(filepath.Join(path, "core.asar")); err != nil {
+			release.err = fmt.Errorf("discord_desktop_core has no intact core.asar - launch Discord to let it download its modules: %w", err)
 			return
 		}
+	}
 
-		if internal.BdInstalledRelease == nil || *internal.BdInstalledRelease != *internal.BdLatestRelease {
-			client := github.NewClient(nil)
-			bdRelease, _, err := client.Repositories.GetRelease(release.ctx, "BetterDiscord", "BetterDiscord", *internal.BdLatestRelease)
-			if err != nil {
-				release.err = fmt.Errorf("error getting latest BetterDiscord release: %w", err)
-				return
+	// the previous client mod has to be removed when switching to another
+	if internal.BdInstalledRelease != nil && internal.InstalledInjector != injector.String() {
+		if installed, err := getInjector(internal.InstalledInjector); err == nil {
+			release.message = "Removing " + installed.name()
+			release.flush(internal, true)
+			if err = installed.remove(path); err != nil {
+				release.err = err
+				release.flush(internal, true)
 			}
+		}
+		internal.BdInstalledRelease = nil
+		internal.BdInstalled = nil
+	}
 
-			for _, asset := range bdRelease.Assets {
-				if *asset.Name != "betterdiscord.asar" {
-					continue
-				}
-
-				if err = os.MkdirAll(path, 0755); err != nil {
-					release.err = fmt.Errorf("error creating '%s': %w", path, err)
-					return
-				}
+	if internal.BdEnabled {
+		if internal.BdLatestRelease == nil && release.checkForBdUpdates(internal) != nil {
+			return
+		}
 
-				asarPath := filepath.Join(path, "betterdiscord.asar")
+		// Discord's module updater may have removed it since it was installed
+		if internal.BdInstalledRelease == nil || *internal.BdInstalledRelease != *internal.BdLatestRelease || !injector.isInstalled(path) {
+			if err = os.MkdirAll(path, 0755); err != nil {
+				release.err = fmt.Errorf("error creating '%s': %w", path, err)
+				return
+			}
 
-				asar, err := os.OpenFile(asarPath, os.O_CREATE|os.O_WRONLY, 0600)
-				if err != nil {
-					release.err = fmt.Errorf("error opening '%s': %w", asarPath, err)
-					return
-				}
+			release.message = "Downloading " + injector.name()
+			release.flush(internal, true)
 
-				release.message = "Downloading BetterDiscord"
+			if err = injector.install(release.ctx, getGithubClient(), path, *internal.BdLatestRelease, func(progress uint8) {
+				release.progress = progress
 				release.flush(internal, true)
-
-				if err = download(release.ctx, *asset.BrowserDownloadURL, asar, func(progress uint8) {
-					release.progress = progress
-					release.flush(internal, true)
-				}); err != nil {
-					release.err = fmt.Errorf("error downloading BetterDiscord: %w", err)
-					return
-				}
-
-				internal.BdInstalledRelease = internal.BdLatestRelease
-
-				break
+			}); err != nil {
+				release.err = err
+				return
 			}
+
+			internal.BdInstalledRelease = internal.BdLatestRelease
+			internal.BdInstalled = internal.BdLatest
+			internal.InstalledInjector = injector.String()
 		}
 	} else {
 		if internal.BdInstalledRelease == nil {
@@ -923,41 +1252,31 @@ func (release *release) applyBd() {
 			return
 		}
 
-		release.message = "Removing BetterDiscord"
+		release.message = "Removing " + injector.name()
 
-		if err = os.Remove(filepath.Join(path, "betterdiscord.asar")); err != nil && !errors.Is(err, os.ErrNotExist) {
-			release.err = fmt.Errorf("error deleting BetterDiscord: %w", err)
+		if err = injector.remove(path); err != nil {
+			release.err = err
 			release.flush(internal, true)
 		}
 
 		internal.BdInstalledRelease = nil
 		internal.BdLatestRelease = nil
+		internal.BdInstalled = nil
+		internal.BdLatest = nil
+		internal.InstalledInjector = ""
 	}
 	release.flush(internal, true)
 
-	indexJsPath := filepath.Join(path, "index.js")
-	indexJs, err := os.OpenFile(indexJsPath, os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		release.err = fmt.Errorf("error opening '%s': %w", indexJsPath, err)
+	if !internal.BdEnabled {
+		if err = restoreIndexJs(path, force); err != nil {
+			release.err = err
+		}
 		return
 	}
 
-	var content string
-	if internal.BdEnabled {
-		content = "require(\"./betterdiscord.asar\");\nmodule.exports = require(\"./core.asar\");"
-		release.message = "Injecting BetterDiscord"
-		release.flush(internal, true)
-	} else {
-		content = "module.exports = require('./core.asar');"
-	}
-
-	accumulated := 0
-	for accumulated < len(content) {
-		n, err := indexJs.WriteString(content)
-		if err != nil {
-			release.err = fmt.Errorf("error writing to '%s': %w", indexJsPath, err)
-			return
-		}
-		accumulated += n
+	release.message = "Injecting " + injector.name()
+	release.flush(internal, true)
+	if err = injectIndexJs(path, injector.shim(), force); err != nil {
+		release.err = err
 	}
 }
@@ -0,0 +1,126 @@
+package dislaunch
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+)
+
+// `splitArguments` splits `line` into arguments following the POSIX
+// shell's quoting rules, but without any of its expansions. Since the
+// arguments are never actually passed through a shell, unquoted
+// characters which would mean something to one are rejected rather
+// than silently passed on as-is.
+func splitArguments(line string) ([]string, error) {
+	var arguments []string
+	var argument strings.Builder
+	inArgument := false
+
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case c == 0:
+			return nil, errors.New("arguments cannot contain NUL")
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			if inArgument {
+				arguments = append(arguments, argument.String())
+				argument.Reset()
+				inArgument = false
+			}
+		case c == '#' && !inArgument:
+			// the rest of the line is a comment
+			i = len(line)
+		case c == '\\':
+			i++
+			if i == len(line) {
+				return nil, errors.New("trailing backslash")
+			}
+			// backslash-newline is a line continuation
+			if line[i] != '\n' {
+				argument.WriteByte(line[i])
+				inArgument = true
+			}
+		case c == '\'':
+			end := strings.IndexByte(line[i+1:], '\'')
+			if end < 0 {
+				return nil, errors.New("unterminated single quote")
+			}
+			argument.WriteString(line[i+1 : i+1+end])
+			i += end + 1
+			inArgument = true
+		case c == '"':
+			inArgument = true
+			for i++; ; i++ {
+				if i == len(line) {
+					return nil, errors.New("unterminated double quote")
+				}
+
+				c := line[i]
+				if c == '"' {
+					break
+				}
+				switch c {
+				case 0:
+					return nil, errors.New("arguments cannot contain NUL")
+				case '$', '`':
+					return nil, fmt.Errorf("'%c' must be escaped within double quotes since expansions aren't supported", c)
+				case '\\':
+					// within double quotes, backslashes only escape these
+					if i+1 < len(line) && strings.IndexByte("$`\"\\\n", line[i+1]) >= 0 {
+						i++
+						if line[i] != '\n' {
+							argument.WriteByte(line[i])
+						}
+						continue
+					}
+				}
+				argument.WriteByte(c)
+			}
+		case strings.IndexByte("|&;<>()$`", c) >= 0:
+			return nil, fmt.Errorf("'%c' must be quoted since arguments aren't passed through a shell", c)
+		default:
+			argument.WriteByte(c)
+			inArgument = true
+		}
+	}
+
+	if inArgument {
+		arguments = append(arguments, argument.String())
+	}
+	return arguments, nil
+}
+
+func validateEnvironmentName(name string) error {
+	if name == "" {
+		return errors.New("environment variable name cannot be empty")
+	}
+
+	for i, c := range name {
+		if c == '_' || c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || i > 0 && c >= '0' && c <= '9' {
+			continue
+		}
+		return fmt.Errorf("invalid environment variable name: %s", name)
+	}
+	return nil
+}
+
+// `mergeEnvironment` returns `os.Environ()` with `environment` set on
+// top of it. Existing variables have to be removed rather than just
+// appended to, as most programs only read the first occurrence.
+func mergeEnvironment(environment map[string]string) []string {
+	var merged []string
+	for _, variable := range os.Environ() {
+		name, _, _ := strings.Cut(variable, "=")
+		if _, overridden := environment[name]; !overridden {
+			merged = append(merged, variable)
+		}
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(environment)) {
+		merged = append(merged, name+"="+environment[name])
+	}
+	return merged
+}
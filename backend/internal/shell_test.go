@@ -0,0 +1,63 @@
+package dislaunch
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSplitArguments(t *testing.T) {
+	for _, test := range []struct {
+		line      string
+		arguments []string
+	}{
+		{"", nil},
+		{"  \t ", nil},
+		{"stable move /opt/discord", []string{"stable", "move", "/opt/discord"}},
+		{"a  b\tc\nd", []string{"a", "b", "c", "d"}},
+		{"--flag=value --other", []string{"--flag=value", "--other"}},
+		{"'single quoted' \"double quoted\"", []string{"single quoted", "double quoted"}},
+		{"''", []string{""}},
+		{"a'b'\"c\"d", []string{"abcd"}},
+		{"'$HOME `x` \\n'", []string{"$HOME `x` \\n"}},
+		{"\"\\$HOME \\`x\\` \\\" \\\\ \\n\"", []string{"$HOME `x` \" \\ \\n"}},
+		{"a\\ b \\'c", []string{"a b", "'c"}},
+		{"a\\\nb", []string{"ab"}},
+		{"a # comment", []string{"a"}},
+		{"a#b", []string{"a#b"}},
+		// as quoted by the frontend with `Shell.quote`
+		{"stable move '/home/user/it'\\''s (mine) & #1'", []string{"stable", "move", "/home/user/it's (mine) & #1"}},
+		{"config default_install_path '/a;b|c<d>e$f`g'", []string{"config", "default_install_path", "/a;b|c<d>e$f`g"}},
+	} {
+		arguments, err := splitArguments(test.line)
+		if err != nil {
+			t.Errorf("splitArguments(%q) returned error: %s", test.line, err)
+			continue
+		}
+		if !slices.Equal(arguments, test.arguments) {
+			t.Errorf("splitArguments(%q) = %q, want %q", test.line, arguments, test.arguments)
+		}
+	}
+}
+
+func TestSplitArgumentsRejects(t *testing.T) {
+	for _, line := range []string{
+		"a | b",
+		"a & b",
+		"a; b",
+		"a < b",
+		"a > b",
+		"(a)",
+		"$HOME",
+		"`a`",
+		"\"$HOME\"",
+		"\"`a`\"",
+		"'unterminated",
+		"\"unterminated",
+		"trailing\\",
+		"a\x00b",
+	} {
+		if arguments, err := splitArguments(line); err == nil {
+			t.Errorf("splitArguments(%q) = %q, want error", line, arguments)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package dislaunch
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"encoding/json/v2"
 	"errors"
@@ -11,6 +12,8 @@ import (
 	"net"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
 	"syscall"
@@ -20,10 +23,25 @@ import (
 var listener net.Listener
 
 type connectionEntry struct {
+	conn   net.Conn
 	wg     sync.WaitGroup
 	ctx    context.Context
 	cancel context.CancelFunc
-	write  chan []byte
+	outbox *outbox
+	// guarded by `container.mu`
+	events       bool   // whether it's streaming events rather than states
+	seq          uint64 // of the last event sent
+	subscription subscription
+	last         []byte // the last state sent, which isn't sent again
+}
+
+type requesterKey struct{}
+
+// `getRequester` returns the connection making the request `ctx` is
+// of, or nil if it wasn't made by a connection
+func getRequester(ctx context.Context) *connectionEntry {
+	entry, _ := ctx.Value(requesterKey{}).(*connectionEntry)
+	return entry
 }
 
 var container struct {
@@ -31,61 +49,205 @@ var container struct {
 	connections map[net.Conn]*connectionEntry
 }
 
-func setBoolean(set func(bool), setting string) {
+func parseBoolean(setting string) (bool, error) {
 	switch setting {
 	case "0":
-		set(false)
+		return false, nil
 	case "1":
-		set(true)
+		return true, nil
 	default:
-		fmt.Fprintf(os.Stderr, "invalid boolean setting: %s\n", setting)
+		return false, fmt.Errorf("invalid boolean setting: %s", setting)
 	}
 }
 
-func releaseCommand(release *release, data string, command []string) {
+func releaseCommand(command []string) (string, any, error) {
+	if len(command) < 2 {
+		return "", nil, errors.New("release command required")
+	}
+	release := releaseParams{Release: command[0]}
+	var argument string
+	if len(command) > 2 {
+		argument = command[2]
+	}
+
+	// the commands taking a boolean setting
+	switch command[1] {
+	case "bd_enabled", "autostart", "autostart_minimized", "open_asar":
+		if len(command) < 3 {
+			return "", nil, fmt.Errorf("setting required for %s", command[1])
+		}
+		enabled, err := parseBoolean(argument)
+		if err != nil {
+			return "", nil, err
+		}
+		return "release." + command[1], enabledParams{release, enabled}, nil
+	}
+
+	var params any
 	switch command[1] {
 	case "bd_apply":
-		go release.applyBd()
-	case "bd_enabled":
+		params = bdApplyParams{release, slices.Contains(command[2:], "--force")}
+	case "bd_changelog", "bd_unpin", "cancel", "check_for_updates", "install":
+		params = release
+	case "bd_pin":
 		if len(command) < 3 {
-			fmt.Fprintln(os.Stderr, "setting required for BetterDiscord enabled")
-			return
+			return "", nil, errors.New("tag required for BetterDiscord pin")
 		}
-		setBoolean(func(enabled bool) {
-			go release.setBdEnabled(enabled)
-		}, command[2])
+		params = bdPinParams{release, argument}
 	case "bd_channel":
 		if len(command) < 3 {
-			fmt.Fprintln(os.Stderr, "setting required for BetterDiscord channel")
-			return
+			return "", nil, errors.New("setting required for BetterDiscord channel")
 		}
-		switch command[2] {
-		case "stable":
-			go release.setBdChannel(bdStable)
-		case "canary":
-			go release.setBdChannel(bdCanary)
-		default:
-			fmt.Fprintf(os.Stderr, "unknown BetterDiscord channel: %s\n", command[2])
+		params = bdChannelParams{release, bdChannel(argument)}
+	case "injector":
+		if len(command) < 3 {
+			return "", nil, errors.New("injector required to set injector")
 		}
-	case "cancel":
-		release.cancel.Load().(context.CancelFunc)()
-	case "check_for_updates":
-		go release.checkForUpdates()
+		params = injectorParams{release, argument}
 	case "command_line_arguments":
-		// Use a slice directly from `data` so the raw arguments are kept as-is and not lost from `string.Fields`
-		go release.setCommandLineArguments(data[len(release.String()+" command_line_arguments ") : len(data)-1])
-	case "install":
-		go release.install()
+		params = argumentsParams{release, command[2:]}
+	case "environment":
+		if len(command) < 3 {
+			return "", nil, errors.New("variable required to set environment")
+		}
+		// `NAME=value` sets the variable, whereas just `NAME` unsets it
+		if name, value, set := strings.Cut(argument, "="); set {
+			params = environmentParams{release, name, &value}
+		} else {
+			params = environmentParams{release, name, nil}
+		}
+	case "wrapper":
+		params = wrapperParams{release, command[2:]}
+	case "inspect":
+		params = inspectParams{release, command[2:]}
 	case "move":
 		if len(command) < 3 {
-			fmt.Fprintln(os.Stderr, "path required to move release")
-			return
+			return "", nil, errors.New("path required to move release")
 		}
-		go release.move(command[2])
+		params = moveParams{release, argument}
 	case "uninstall":
-		go release.uninstall()
+		uninstall := uninstallParams{releaseParams: release}
+		for _, option := range command[2:] {
+			switch option {
+			case "--trash":
+				uninstall.Trash = true
+			case "--dry-run":
+				uninstall.DryRun = true
+			case "--purge":
+				uninstall.Purge = purgeScopes
+			default:
+				// `--purge=user_data,cache` only purges the given scopes
+				scopes, found := strings.CutPrefix(option, "--purge=")
+				if !found {
+					return "", nil, fmt.Errorf("unknown uninstall option: %s", option)
+				}
+				uninstall.Purge = nil
+				for scope := range strings.SplitSeq(scopes, ",") {
+					uninstall.Purge = append(uninstall.Purge, purgeScope(scope))
+				}
+			}
+		}
+		params = uninstall
+	default:
+		return "", nil, fmt.Errorf("unknown argument: %s", command[1])
+	}
+	return "release." + command[1], params, nil
+}
+
+func addonCommand(command []string) (string, any, error) {
+	if len(command) < 2 {
+		return "", nil, errors.New("addon command required")
+	}
+
+	switch command[1] {
+	case "install":
+		if len(command) < 4 {
+			return "", nil, errors.New("kind and source required to install addon")
+		}
+		return "addon.install", addonInstallParams{addonKind(command[2]), command[3]}, nil
+	case "update":
+		var name string
+		if len(command) > 2 {
+			name = command[2]
+		}
+		return "addon.update", addonParams{name}, nil
+	case "remove":
+		if len(command) < 3 {
+			return "", nil, errors.New("name required to remove addon")
+		}
+		return "addon.remove", addonParams{command[2]}, nil
 	default:
-		fmt.Fprintf(os.Stderr, "unknown argument: %s\n", command[1])
+		return "", nil, fmt.Errorf("unknown addon command: %s", command[1])
+	}
+}
+
+func operationCommand(command []string) (string, any, error) {
+	if len(command) < 3 || command[1] != "cancel" {
+		return "", nil, errors.New("usage: operation cancel <id>")
+	}
+	id, err := strconv.ParseUint(command[2], 10, 64)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid operation ID: %s", command[2])
+	}
+	return "operation.cancel", operationParams{id}, nil
+}
+
+func configCommand(command []string) (string, any, error) {
+	if len(command) < 2 {
+		return "", nil, errors.New("configuration option required")
+	}
+	var argument string
+	if len(command) > 2 {
+		argument = command[2]
+	}
+
+	var params configParams
+	switch command[1] {
+	case "automatically_check_for_updates", "notify_on_update_available", "automatically_install_updates":
+		setting, err := parseBoolean(argument)
+		if err != nil {
+			return "", nil, err
+		}
+		switch command[1] {
+		case "automatically_check_for_updates":
+			params.AutomaticallyCheckForUpdates = &setting
+		case "notify_on_update_available":
+			params.NotifyOnUpdateAvailable = &setting
+		case "automatically_install_updates":
+			params.AutomaticallyInstallUpdates = &setting
+		}
+	case "github_token":
+		params.GithubToken = &argument
+	case "default_install_path":
+		params.DefaultInstallPath = &argument
+	case "max_broadcast_rate":
+		rate, err := strconv.Atoi(argument)
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid maximum broadcast rate: %s", argument)
+		}
+		params.MaxBroadcastRate = &rate
+	default:
+		return "", nil, fmt.Errorf("unknown configuration option: %s", command[1])
+	}
+	return "config.set", params, nil
+}
+
+// `legacyCommand` translates a text command into the method and
+// parameters of the equivalent JSON-RPC request
+func legacyCommand(command []string) (string, any, error) {
+	switch command[0] {
+	case "stable", "ptb", "canary":
+		return releaseCommand(command)
+	case "addon":
+		return addonCommand(command)
+	case "operation":
+		return operationCommand(command)
+	case "config":
+		return configCommand(command)
+	case "subscribe", "unsubscribe":
+		return subscriptionCommand(command)
+	default:
+		return "", nil, fmt.Errorf("unknown action: %s", command[0])
 	}
 }
 
@@ -108,67 +270,50 @@ func startReader(conn net.Conn, entry *connectionEntry) {
 				continue
 			}
 
-			log.Println("Connection received:", data)
-			command := strings.Fields(data)
-			if len(command) == 0 {
+			if strings.HasPrefix(strings.TrimSpace(data), "{") {
+				go func() {
+					if response := handleRequest(context.WithValue(entry.ctx, requesterKey{}, entry), []byte(data)); response != nil {
+						entry.send(response, messageResponse)
+					}
+				}()
 				continue
 			}
 
-			switch command[0] {
-			case "state":
-				go broadcastBackendState()
-			case "stable":
-				go releaseCommand(getStable(), data, command)
-			case "ptb":
-				go releaseCommand(getPtb(), data, command)
-			case "canary":
-				go releaseCommand(getCanary(), data, command)
-			case "config":
-				var argument string
-				if len(command) > 2 {
-					argument = command[2]
-				}
-				// i should be taken out back for nesting switch statements like this. there is certainly a better way of handling commands/subcommands/arguments
-				switch command[1] {
-				case "automatically_check_for_updates":
-					setBoolean(setAutomaticallyCheckForUpdates, argument)
-				case "notify_on_update_available":
-					setBoolean(setNotifyOnUpdateAvailable, argument)
-				case "automatically_install_updates":
-					setBoolean(setAutomaticallyInstallUpdates, argument)
-				case "default_install_path":
-					if err = setDefaultInstallPath(argument); err != nil {
-						fmt.Fprintf(os.Stderr, "error setting default installation path: %s\n", err)
-					}
-				default:
-					fmt.Fprintf(os.Stderr, "unknown configuration option: %s\n", command[1])
-				}
-			default:
-				fmt.Fprintf(os.Stderr, "unknown action: %s\n", command[0])
+			command, err := splitArguments(data)
+			if len(command) >= 3 && command[0] == "config" && command[1] == "github_token" {
+				log.Println("Connection received: config github_token <redacted>")
+			} else {
+				log.Println("Connection received:", data)
 			}
-		}
-	}
-}
-
-func startWriter(conn net.Conn, entry *connectionEntry) {
-	for message := range entry.write {
-		select {
-		case <-entry.ctx.Done():
-			log.Printf("Connection %p already closed - dropping message: %s\n", conn, message)
-			continue
-		default:
-			if err := conn.SetWriteDeadline(time.Now().Add(5 * time.Second)); err != nil {
-				fmt.Fprintf(os.Stderr, "error setting write deadline: %s\n", err)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error parsing command: %s\n", err)
+				continue
+			}
+			if len(command) == 0 {
+				continue
 			}
 
-			if _, err := conn.Write(message); err != nil {
-				if errors.Is(err, syscall.EPIPE) || errors.Is(err, syscall.ECONNRESET) {
-					entry.cancel()
-					return
-				}
+			// both were answered by broadcasting the state before there were responses
+			if command[0] == "state" || len(command) >= 2 && command[0] == "addon" && command[1] == "list" {
+				// sent even if it's what the connection was last sent, as it's waiting on it
+				events.mu.Lock()
+				container.mu.Lock()
+				resendState(entry)
+				container.mu.Unlock()
+				events.mu.Unlock()
+				continue
+			}
 
-				fmt.Fprintf(os.Stderr, "error writing to connection: %s\nMessage: %s", err, message)
+			method, params, err := legacyCommand(command)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				continue
 			}
+			go func() {
+				if _, err := call(context.WithValue(entry.ctx, requesterKey{}, entry), method, params); err != nil {
+					fmt.Fprintf(os.Stderr, "error handling command '%s': %s\n", strings.TrimSpace(data), err)
+				}
+			}()
 		}
 	}
 }
@@ -183,17 +328,19 @@ func handleConnection(conn net.Conn) {
 
 	ctx, cancel := context.WithCancel(context.Background())
 	entry := &connectionEntry{
+		conn:   conn,
 		ctx:    ctx,
 		cancel: cancel,
-		write:  make(chan []byte),
+		outbox: newOutbox(),
 	}
 	container.connections[conn] = entry
 	container.mu.Unlock()
 	log.Println("Accepted connection", conn)
 
+	greet(entry)
 	go startReader(conn, entry)
 	entry.wg.Go(func() {
-		startWriter(conn, entry)
+		startWriter(entry)
 	})
 
 	<-entry.ctx.Done()
@@ -201,7 +348,6 @@ func handleConnection(conn net.Conn) {
 	delete(container.connections, conn)
 	container.mu.Unlock()
 	log.Println("Closing connection", conn)
-	close(entry.write)
 	entry.wg.Wait()
 	if err := conn.Close(); err != nil {
 		fmt.Fprintf(os.Stderr, "error closing connection: %s\n", err)
@@ -213,7 +359,12 @@ func StartListener() (func(), error) {
 		return nil, errors.New("listener already started")
 	}
 
-	socket := filepath.Join(GetRuntimeDirectory(), "dislaunch.sock")
+	runtimeDirectory := GetRuntimeDirectory()
+	if err := verifyRuntimeDirectory(runtimeDirectory); err != nil {
+		return nil, fmt.Errorf("refusing to create socket: %w", err)
+	}
+
+	socket := filepath.Join(runtimeDirectory, "dislaunch.sock")
 	if err := os.Remove(socket); err != nil && !errors.Is(err, os.ErrNotExist) {
 		return nil, fmt.Errorf("error removing existing socket at '%s': %w\n", socket, err)
 	}
@@ -223,6 +374,11 @@ func StartListener() (func(), error) {
 	if err != nil {
 		return nil, fmt.Errorf("error creating socket at '%s': %w\n", socket, err)
 	}
+	if err = setSocketPermissions(runtimeDirectory, socket); err != nil {
+		listener.Close()
+		listener = nil
+		return nil, fmt.Errorf("error setting permissions of socket at '%s': %w\n", socket, err)
+	}
 	log.Println("Listener started at " + socket)
 
 	container.connections = make(map[net.Conn]*connectionEntry)
@@ -234,11 +390,17 @@ func StartListener() (func(), error) {
 				fmt.Fprintf(os.Stderr, "error accepting connection: %s\n", err)
 				continue
 			}
+			if err = verifyPeer(conn); err != nil {
+				fmt.Fprintf(os.Stderr, "refusing connection: %s\n", err)
+				conn.Close()
+				continue
+			}
 			go handleConnection(conn)
 		}
 	}()
 
 	go startIntervals()
+	go startWatcher()
 
 	return func() {
 		if listener == nil {
@@ -250,11 +412,13 @@ func StartListener() (func(), error) {
 			fmt.Fprintf(os.Stderr, "error closing listener: %s\n", err)
 		}
 		listener = nil
+		// so that clients see whatever changed last before being disconnected
+		flushBroadcast()
 
 		container.mu.Lock()
 		defer container.mu.Unlock()
 		for _, entry := range container.connections {
-			entry.cancel()
+			entry.close()
 		}
 	}, nil
 }
@@ -264,6 +428,51 @@ type backendState struct {
 	Ptb           *releaseState `json:"ptb"`
 	Canary        *releaseState `json:"canary"`
 	Configuration Configuration `json:"config"`
+	Addons        *addonsState  `json:"addons"`
+	// `nil` until a request has been made to the GitHub API
+	GithubRateLimit *githubRateLimit `json:"github_rate_limit"`
+}
+
+// `getBackendState` returns the state as it's sent to clients
+func getBackendState() backendState {
+	configuration := getCachedConfiguration()
+	// the token isn't for other clients to see, only whether it's set
+	if configuration.GithubToken != "" {
+		configuration.GithubToken = "*"
+	}
+
+	return backendState{
+		Stable:          getStable().getState(),
+		Ptb:             getPtb().getState(),
+		Canary:          getCanary().getState(),
+		Configuration:   configuration,
+		Addons:          getAddonsState(),
+		GithubRateLimit: getGithubRateLimit(),
+	}
+}
+
+const defaultMaxBroadcastRate = 10
+
+// Processes report progress far more often than is worth sending
+// to clients, so `broadcastBackendState` only marks the state as
+// changed. It's then sent at most `MaxBroadcastRate` times per
+// second, and always once more after the last change so that
+// clients never miss the final state.
+var broadcaster struct {
+	mu    sync.Mutex
+	dirty bool
+	timer *time.Timer // pending broadcast, if any
+	last  time.Time
+	// held whilst sending, so that a broadcast never overtakes an earlier one
+	sending sync.Mutex
+}
+
+func getBroadcastInterval() time.Duration {
+	rate := getCachedConfiguration().MaxBroadcastRate
+	if rate <= 0 {
+		rate = defaultMaxBroadcastRate
+	}
+	return time.Second / time.Duration(rate)
 }
 
 func broadcastBackendState() {
@@ -271,12 +480,42 @@ func broadcastBackendState() {
 		return
 	}
 
-	buffer, err := json.Marshal(backendState{
-		Stable:        getStable().getState(),
-		Ptb:           getPtb().getState(),
-		Canary:        getCanary().getState(),
-		Configuration: getConfiguration(),
-	}, json.OmitZeroStructFields(true))
+	broadcaster.mu.Lock()
+	defer broadcaster.mu.Unlock()
+
+	broadcaster.dirty = true
+	if broadcaster.timer != nil {
+		return
+	}
+	broadcaster.timer = time.AfterFunc(max(time.Until(broadcaster.last.Add(getBroadcastInterval())), 0), flushBroadcast)
+}
+
+// `flushBroadcast` sends the state if it has changed since it was
+// last sent
+func flushBroadcast() {
+	broadcaster.sending.Lock()
+	defer broadcaster.sending.Unlock()
+
+	broadcaster.mu.Lock()
+	if broadcaster.timer != nil {
+		broadcaster.timer.Stop()
+		broadcaster.timer = nil
+	}
+	dirty := broadcaster.dirty
+	broadcaster.dirty = false
+	broadcaster.last = time.Now()
+	broadcaster.mu.Unlock()
+
+	if dirty {
+		sendBackendState()
+	}
+}
+
+func sendBackendState() {
+	state := getBackendState()
+	sendEvents(state)
+
+	buffer, err := json.Marshal(state, json.OmitZeroStructFields(true))
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "error marshalling backend state to JSON: %s\n", err)
 		return
@@ -287,11 +526,25 @@ func broadcastBackendState() {
 	container.mu.Lock()
 	defer container.mu.Unlock()
 	for _, entry := range container.connections {
-		select {
-		case <-entry.ctx.Done():
+		if entry.events {
 			continue
-		case entry.write <- message:
+		}
+
+		filtered := message
+		if entry.subscription.releases != nil || entry.subscription.kinds != nil {
+			buffer, err := json.Marshal(entry.subscription.filter(state), json.OmitZeroStructFields(true))
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error marshalling filtered backend state to JSON: %s\n", err)
+				continue
+			}
+			filtered = append(buffer, '\n')
+		}
+		// e.g. when only what it isn't subscribed to changed
+		if bytes.Equal(filtered, entry.last) {
 			continue
 		}
+		entry.last = filtered
+
+		entry.send(filtered, messageState)
 	}
 }
@@ -0,0 +1,206 @@
+package dislaunch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+)
+
+// By default, connections are sent everything. Once a connection
+// subscribes to particular releases or event kinds, it's only sent
+// those, and may subscribe to more or unsubscribe from them later.
+// Connections receiving whole states rather than events are sent
+// only the parts of the state those kinds of event would describe.
+
+var eventKinds = []eventKind{eventProgress, eventStatusChanged, eventError, eventReleaseChanged, eventConfigChanged, eventStateChanged, eventOperationFinished}
+
+type subscription struct {
+	releases map[string]bool // every release when nil
+	kinds    map[eventKind]bool
+}
+
+type subscriptionParams struct {
+	Releases []string    `json:"releases"`
+	Kinds    []eventKind `json:"kinds"`
+}
+
+func (params subscriptionParams) validate() error {
+	for _, release := range params.Releases {
+		if !slices.Contains(releaseIds, release) {
+			return invalidParams("unknown release: '%s'", release)
+		}
+	}
+	for _, kind := range params.Kinds {
+		if !slices.Contains(eventKinds, kind) {
+			return invalidParams("unknown event kind: '%s'", kind)
+		}
+	}
+	return nil
+}
+
+// `subscribe` adds `names` to `set`, which is narrowed down to just
+// `names` if it hasn't been subscribed to yet
+func subscribe[T comparable](set map[T]bool, names []T) map[T]bool {
+	if len(names) == 0 {
+		return set
+	}
+	if set == nil {
+		set = make(map[T]bool)
+	}
+	for _, name := range names {
+		set[name] = true
+	}
+	return set
+}
+
+// `unsubscribe` removes `names` from `set`, or from `all` if it
+// hasn't been subscribed to yet
+func unsubscribe[T comparable](set map[T]bool, all []T, names []T) map[T]bool {
+	if len(names) == 0 {
+		return set
+	}
+	if set == nil {
+		set = make(map[T]bool)
+		for _, name := range all {
+			set[name] = true
+		}
+	}
+	for _, name := range names {
+		delete(set, name)
+	}
+	return set
+}
+
+func (subscription *subscription) wantsRelease(release string) bool {
+	return subscription.releases == nil || subscription.releases[release]
+}
+
+func (subscription *subscription) wantsKind(kind eventKind) bool {
+	return subscription.kinds == nil || subscription.kinds[kind]
+}
+
+func (subscription *subscription) wants(event event) bool {
+	if event.Kind == eventSnapshot {
+		return true
+	}
+	return subscription.wantsKind(event.Kind) && (event.Release == "" || subscription.wantsRelease(event.Release))
+}
+
+// `filterRelease` returns a copy of `state` without the fields of
+// the kinds of event that aren't subscribed to, or nil if none are
+func (subscription *subscription) filterRelease(state *releaseState) *releaseState {
+	if state == nil || !slices.ContainsFunc([]eventKind{eventProgress, eventStatusChanged, eventError, eventReleaseChanged}, subscription.wantsKind) {
+		return nil
+	}
+
+	filtered := *state
+	if !subscription.wantsKind(eventProgress) {
+		filtered.Message = ""
+		filtered.Progress = 0
+	}
+	if !subscription.wantsKind(eventStatusChanged) {
+		filtered.Status = statusNone
+	}
+	if !subscription.wantsKind(eventError) {
+		filtered.Error = ""
+	}
+	if !subscription.wantsKind(eventReleaseChanged) {
+		filtered = releaseState{
+			Status:   filtered.Status,
+			Message:  filtered.Message,
+			Progress: filtered.Progress,
+			Error:    filtered.Error,
+		}
+	}
+	return &filtered
+}
+
+// `filter` returns `state` with only what's subscribed to
+func (subscription *subscription) filter(state backendState) backendState {
+	if subscription.releases == nil && subscription.kinds == nil {
+		return state
+	}
+
+	var filtered backendState
+	if subscription.wantsRelease("stable") {
+		filtered.Stable = subscription.filterRelease(state.Stable)
+	}
+	if subscription.wantsRelease("ptb") {
+		filtered.Ptb = subscription.filterRelease(state.Ptb)
+	}
+	if subscription.wantsRelease("canary") {
+		filtered.Canary = subscription.filterRelease(state.Canary)
+	}
+	if subscription.wantsKind(eventConfigChanged) {
+		filtered.Configuration = state.Configuration
+	}
+	if subscription.wantsKind(eventStateChanged) {
+		filtered.Addons = state.Addons
+		filtered.GithubRateLimit = state.GithubRateLimit
+	}
+	return filtered
+}
+
+// `setSubscription` subscribes (or unsubscribes) the connection
+// making the request to `params`, returning what it's now
+// subscribed to
+func setSubscription(ctx context.Context, params subscriptionParams, subscribing bool) (any, error) {
+	if err := params.validate(); err != nil {
+		return nil, err
+	}
+	entry := getRequester(ctx)
+	if entry == nil {
+		return nil, errors.New("not a connection")
+	}
+
+	events.mu.Lock()
+	defer events.mu.Unlock()
+	container.mu.Lock()
+	defer container.mu.Unlock()
+	if container.connections[entry.conn] != entry {
+		return nil, context.Canceled
+	}
+
+	subscription := &entry.subscription
+	if subscribing {
+		subscription.releases = subscribe(subscription.releases, params.Releases)
+		subscription.kinds = subscribe(subscription.kinds, params.Kinds)
+	} else {
+		subscription.releases = unsubscribe(subscription.releases, releaseIds, params.Releases)
+		subscription.kinds = unsubscribe(subscription.kinds, eventKinds, params.Kinds)
+	}
+	// so that it's sent the state as it's now filtered, including
+	// the current values of whatever it's just subscribed to, which
+	// events alone would only send once they next change
+	if subscribing || !entry.events {
+		resendState(entry)
+	}
+
+	current := subscriptionParams{Releases: releaseIds, Kinds: eventKinds}
+	if subscription.releases != nil {
+		current.Releases = slices.Sorted(maps.Keys(subscription.releases))
+	}
+	if subscription.kinds != nil {
+		current.Kinds = slices.Sorted(maps.Keys(subscription.kinds))
+	}
+	return current, nil
+}
+
+// `subscriptionCommand` translates the text commands `subscribe`
+// and `unsubscribe`, which take any mix of releases and event kinds
+func subscriptionCommand(command []string) (string, any, error) {
+	var params subscriptionParams
+	for _, name := range command[1:] {
+		switch {
+		case slices.Contains(releaseIds, name):
+			params.Releases = append(params.Releases, name)
+		case slices.Contains(eventKinds, eventKind(name)):
+			params.Kinds = append(params.Kinds, eventKind(name))
+		default:
+			return "", nil, fmt.Errorf("unknown release or event kind: %s", name)
+		}
+	}
+	return command[0], params, nil
+}
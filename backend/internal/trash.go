@@ -0,0 +1,139 @@
+package dislaunch
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// Implements just enough of the FreeDesktop.org trash specification
+// to move a file or directory to the trash such that file managers
+// can restore it. See https://specifications.freedesktop.org/trash-spec/latest/
+
+func getDevice(path string) (uint64, error) {
+	stat, err := os.Lstat(path)
+	if err != nil {
+		return 0, err
+	}
+
+	sys, ok := stat.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, fmt.Errorf("error getting device of '%s'", path)
+	}
+	return sys.Dev, nil
+}
+
+func getMountPoint(path string) (string, error) {
+	device, err := getDevice(path)
+	if err != nil {
+		return "", err
+	}
+
+	for path != "/" {
+		parent := filepath.Dir(path)
+		parentDevice, err := getDevice(parent)
+		if err != nil {
+			return "", err
+		}
+		if parentDevice != device {
+			break
+		}
+		path = parent
+	}
+	return path, nil
+}
+
+// Files can only be renamed into a trash directory on the same
+// filesystem, so files outside of the home trash's filesystem go
+// into a `.Trash-$uid` directory at the top of their own instead
+func getTrashDirectory(path string) (trash string, topDirectory string, err error) {
+	homeTrash := filepath.Join(getHomeXdgDirectory("XDG_DATA_HOME", filepath.Join(".local", "share")), "Trash")
+	if err = os.MkdirAll(homeTrash, 0700); err != nil {
+		return "", "", fmt.Errorf("error creating home trash '%s': %w", homeTrash, err)
+	}
+
+	homeDevice, err := getDevice(homeTrash)
+	if err != nil {
+		return "", "", fmt.Errorf("error getting device of home trash: %w", err)
+	}
+	device, err := getDevice(path)
+	if err != nil {
+		return "", "", fmt.Errorf("error getting device of '%s': %w", path, err)
+	}
+	if device == homeDevice {
+		return homeTrash, "", nil
+	}
+
+	topDirectory, err = getMountPoint(path)
+	if err != nil {
+		return "", "", fmt.Errorf("error getting mount point of '%s': %w", path, err)
+	}
+	return filepath.Join(topDirectory, ".Trash-"+strconv.Itoa(os.Getuid())), topDirectory, nil
+}
+
+func moveToTrash(path string) error {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+
+	trash, topDirectory, err := getTrashDirectory(path)
+	if err != nil {
+		return err
+	}
+
+	files := filepath.Join(trash, "files")
+	info := filepath.Join(trash, "info")
+	for _, directory := range []string{files, info} {
+		if err = os.MkdirAll(directory, 0700); err != nil {
+			return fmt.Errorf("error creating trash directory '%s': %w", directory, err)
+		}
+	}
+
+	// trash in a top directory stores paths relative to it
+	infoPath := path
+	if topDirectory != "" {
+		if infoPath, err = filepath.Rel(topDirectory, path); err != nil {
+			return err
+		}
+	}
+	content := fmt.Sprintf("[Trash Info]\nPath=%s\nDeletionDate=%s\n", (&url.URL{Path: infoPath}).EscapedPath(), time.Now().Format("2006-01-02T15:04:05"))
+
+	// The info file is created exclusively first to reserve
+	// the name, as there may already be something of the same
+	// name in the trash
+	name := filepath.Base(path)
+	for i := 2; ; i++ {
+		if _, err := os.Lstat(filepath.Join(files, name)); err == nil {
+			name = filepath.Base(path) + "." + strconv.Itoa(i)
+			continue
+		}
+
+		infoFile, err := os.OpenFile(filepath.Join(info, name+".trashinfo"), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if errors.Is(err, os.ErrExist) {
+			name = filepath.Base(path) + "." + strconv.Itoa(i)
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("error creating trash info file: %w", err)
+		}
+
+		_, err = infoFile.WriteString(content)
+		infoFile.Close()
+		if err != nil {
+			os.Remove(infoFile.Name())
+			return fmt.Errorf("error writing trash info file: %w", err)
+		}
+
+		if err = os.Rename(path, filepath.Join(files, name)); err != nil {
+			os.Remove(infoFile.Name())
+			return fmt.Errorf("error moving '%s' to trash: %w", path, err)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,354 @@
+package dislaunch
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type purgeScope string
+
+const (
+	// Not a purge scope itself, but the scope of everything removed by a normal uninstall
+	purgeInstall  purgeScope = "install"
+	purgeUserData purgeScope = "user_data"
+	purgeModules  purgeScope = "modules"
+	purgeBd       purgeScope = "bd"
+	purgeCache    purgeScope = "cache"
+	purgeState    purgeScope = "state"
+)
+
+// Ordered such that more specific scopes are removed before those
+// containing them, so that sizes aren't counted twice
+var purgeScopes = []purgeScope{purgeBd, purgeModules, purgeUserData, purgeCache, purgeState}
+
+type uninstallOptions struct {
+	// Move to the trash instead of deleting
+	trash bool
+	// Only report what would be removed
+	dryRun bool
+	purge  map[purgeScope]bool
+}
+
+type removalAction string
+
+const (
+	removalDelete removalAction = "delete"
+	removalTrash  removalAction = "trash"
+	removalNone   removalAction = "none" // dry run
+)
+
+type removal struct {
+	Scope  purgeScope    `json:"scope"`
+	Path   string        `json:"path"`
+	Size   int64         `json:"size"`
+	Action removalAction `json:"action"`
+}
+
+// Directories which must never be removed, nor anything containing them
+func getProtectedDirectories() []string {
+	protected := []string{"/", "/bin", "/boot", "/dev", "/etc", "/home", "/lib", "/lib64", "/mnt", "/opt", "/proc", "/root", "/run", "/sbin", "/srv", "/sys", "/tmp", "/usr", "/var"}
+
+	if home, err := os.UserHomeDir(); err == nil {
+		protected = append(protected, home)
+	}
+	for _, directory := range []func() (string, error){os.UserConfigDir, os.UserCacheDir} {
+		if directory, err := directory(); err == nil {
+			protected = append(protected, directory)
+		}
+	}
+	protected = append(protected,
+		getHomeXdgDirectory("XDG_DATA_HOME", filepath.Join(".local", "share")),
+		getHomeXdgDirectory("XDG_STATE_HOME", filepath.Join(".local", "state")),
+	)
+
+	return protected
+}
+
+func isWithin(path string, directory string) bool {
+	relative, err := filepath.Rel(directory, path)
+	return err == nil && relative != ".." && !strings.HasPrefix(relative, ".."+string(filepath.Separator))
+}
+
+// Since the install path comes from the gob, a corrupted or
+// tampered gob could point it anywhere. So, before removing
+// anything, make sure it really is an installation of this
+// release and not something important.
+func (release *release) assertRemovable(internal *releaseInternal) error {
+	if !filepath.IsAbs(internal.InstallPath) {
+		return fmt.Errorf("install path is not absolute: %s", internal.InstallPath)
+	}
+
+	path := filepath.Join(internal.InstallPath, release.pathName)
+
+	installRealpath, err := filepath.EvalSymlinks(internal.InstallPath)
+	if err != nil {
+		return fmt.Errorf("error getting realpath of install path '%s': %w", internal.InstallPath, err)
+	}
+	realpath, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return fmt.Errorf("error getting realpath of '%s': %w", path, err)
+	}
+	if realpath == installRealpath || !isWithin(realpath, installRealpath) {
+		return fmt.Errorf("'%s' resolves to '%s', which is outside of the install path '%s'", path, realpath, installRealpath)
+	}
+
+	for _, protected := range getProtectedDirectories() {
+		if protectedRealpath, err := filepath.EvalSymlinks(protected); err == nil {
+			protected = protectedRealpath
+		}
+		if isWithin(protected, realpath) {
+			return fmt.Errorf("'%s' is or contains the protected directory '%s'", realpath, protected)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(path, "resources", "build_info.json")); err != nil {
+		return fmt.Errorf("'%s' doesn't look like an installation of Discord: %w", path, err)
+	}
+	if _, err := release.getVersion(internal); err != nil {
+		return fmt.Errorf("error getting installed version from '%s': %w", path, err)
+	}
+
+	return nil
+}
+
+func getDiskUsage(path string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(path, func(_ string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		size += info.Size()
+		return nil
+	})
+	return size, err
+}
+
+// `remove` removes `path` according to `options` and records it in
+// `release.removals`. Nonexistent paths are silently skipped.
+func (release *release) remove(scope purgeScope, path string, options uninstallOptions) error {
+	size, err := getDiskUsage(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("error getting size of '%s': %w", path, err)
+	}
+	if options.dryRun {
+		// Nothing is removed by a dry run, so anything an earlier scope
+		// would have removed is still there to be counted again
+		for _, removal := range release.removals {
+			if isWithin(path, removal.Path) {
+				return nil
+			}
+			if isWithin(removal.Path, path) {
+				size -= removal.Size
+			}
+		}
+	}
+	// the gob is written back with the defaults once the uninstall has finished
+	if scope == purgeState {
+		size = 0
+	}
+
+	action := removalDelete
+	switch {
+	case options.dryRun:
+		action = removalNone
+	case options.trash:
+		action = removalTrash
+		if err = moveToTrash(path); err != nil {
+			return err
+		}
+	default:
+		if err = os.RemoveAll(path); err != nil {
+			return err
+		}
+	}
+
+	release.removals = append(release.removals, removal{
+		Scope:  scope,
+		Path:   path,
+		Size:   size,
+		Action: action,
+	})
+	return nil
+}
+
+// Discord keeps its user data, including modules, in the lowercase
+// form of its path name, whereas BetterDiscord keeps its own data for
+// each release under its release channel
+func (release *release) getPurgePaths(scope purgeScope) ([]string, error) {
+	config, err := os.UserConfigDir()
+	if err != nil {
+		return nil, fmt.Errorf("error getting user config directory: %w", err)
+	}
+	userData := filepath.Join(config, strings.ToLower(release.pathName))
+
+	switch scope {
+	case purgeUserData:
+		return []string{userData}, nil
+	case purgeModules:
+		return filepath.Glob(filepath.Join(userData, "*", "modules"))
+	case purgeBd:
+		directories, err := filepath.Glob(filepath.Join(userData, "*", "modules", "discord_desktop_core"))
+		if err != nil {
+			return nil, err
+		}
+		var paths []string
+		for _, directory := range directories {
+			for _, injector := range injectors {
+				for _, path := range injector.paths(directory) {
+					if _, err := os.Lstat(path); err == nil {
+						paths = append(paths, path)
+					}
+				}
+			}
+		}
+		return append(paths, filepath.Join(config, "BetterDiscord", "data", release.id)), nil
+	case purgeCache:
+		cache, err := getCacheDislaunchDirectory()
+		if err != nil {
+			return nil, err
+		}
+		// tarballs are named `<id>.tar.gz` or `<id>-<version>.tar.gz`, possibly with `.part`
+		return filepath.Glob(filepath.Join(cache, release.id+"[.-]*"))
+	case purgeState:
+		return []string{release.gobPath}, nil
+	default:
+		return nil, fmt.Errorf("unknown purge scope: %s", scope)
+	}
+}
+
+func (release *release) purge(internal *releaseInternal, options uninstallOptions) {
+	for _, scope := range purgeScopes {
+		if !options.purge[scope] {
+			continue
+		}
+
+		release.message = "Purging " + string(scope)
+		release.flush(internal, true)
+
+		paths, err := release.getPurgePaths(scope)
+		if err != nil {
+			release.err = fmt.Errorf("error getting paths to purge for scope '%s': %w", scope, err)
+			release.flush(internal, true)
+			continue
+		}
+
+		for _, path := range paths {
+			if err = release.remove(scope, path, options); err != nil {
+				release.err = fmt.Errorf("error purging '%s': %w", path, err)
+				release.flush(internal, true)
+				continue
+			}
+
+			// Without the client mod, Discord would fail to load the injected
+			// `index.js`. If the modules themselves are being removed anyway,
+			// Discord will just download them again.
+			if scope == purgeBd && !options.dryRun && !options.purge[purgeModules] && !options.purge[purgeUserData] && filepath.Base(filepath.Dir(path)) == "discord_desktop_core" {
+				if err = restoreIndexJs(filepath.Dir(path), true); err != nil {
+					release.err = err
+					release.flush(internal, true)
+				}
+			}
+		}
+
+		if options.dryRun {
+			continue
+		}
+		switch scope {
+		case purgeBd:
+			internal.BdEnabled = false
+			internal.BdInstalledRelease = nil
+			internal.BdLatestRelease = nil
+			internal.BdInstalled = nil
+			internal.BdLatest = nil
+		case purgeState:
+			// The release lives on for as long as the daemon does, so
+			// its defaults are written back once the process finishes
+			*internal = releaseInternal{BdChannel: bdStable}
+		}
+	}
+}
+
+func (release *release) uninstall(options uninstallOptions) (result error) {
+	internal, reset, err := release.takeOver()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		result = reset()
+	}()
+
+	// Purging is still useful if the release has already been uninstalled
+	if internal.InstallPath == "" && len(options.purge) == 0 {
+		return
+	}
+
+	// `removals` is deliberately left alone by `reset` so that the
+	// results of a dry run stay in the state until the next uninstall
+	release.removals = nil
+
+	if internal.InstallPath != "" && !release.uninstallInstall(internal, options) {
+		return
+	}
+
+	release.purge(internal, options)
+	release.flush(internal, true)
+	return
+}
+
+// `uninstallInstall` removes the installation itself along with its
+// desktop entries and returns whether it's safe to continue purging
+func (release *release) uninstallInstall(internal *releaseInternal, options uninstallOptions) bool {
+	path := filepath.Join(internal.InstallPath, release.pathName)
+
+	release.status = statusUninstall
+	switch {
+	case options.dryRun:
+		release.message = "Checking what would be removed from " + path
+	case options.trash:
+		release.message = "Moving " + path + " to the trash"
+	default:
+		release.message = "Deleting " + path
+	}
+	release.progress = 101
+	release.flush(internal, true)
+
+	if err := release.assertRemovable(internal); err != nil {
+		release.err = fmt.Errorf("refusing to uninstall release '%s': %w", release, err)
+		return false
+	}
+
+	if err := release.remove(purgeInstall, path, options); err != nil {
+		// a partially deleted installation can't be recovered from
+		if !options.trash {
+			release.status = statusFatal
+		}
+		release.err = fmt.Errorf("error uninstalling release '%s' from '%s': %w", release, internal.InstallPath, err)
+		release.flush(internal, true)
+		return false
+	}
+
+	for _, entry := range []string{release.desktopEntryPath(), release.autostartEntryPath()} {
+		if err := release.remove(purgeInstall, entry, options); err != nil {
+			release.err = fmt.Errorf("error removing '%s' for release '%s': %w", entry, release, err)
+			release.flush(internal, true)
+		}
+	}
+
+	if !options.dryRun {
+		internal.InstallPath = ""
+		internal.Autostart = false
+	}
+	return true
+}
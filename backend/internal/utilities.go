@@ -65,3 +65,31 @@ func getCacheDislaunchDirectory() (string, error) {
 
 	return path, nil
 }
+
+// `writeFileAtomically` writes `content` to a temporary file beside
+// `path` before renaming it over `path`, so that anything reading
+// `path` sees either all of the old contents or all of the new
+func writeFileAtomically(path string, content []byte, perm os.FileMode) error {
+	temporary, err := os.CreateTemp(filepath.Dir(path), ".dislaunch-"+filepath.Base(path)+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temporary.Name()) // fails harmlessly once renamed
+
+	if _, err = temporary.Write(content); err != nil {
+		temporary.Close()
+		return err
+	}
+	if err = temporary.Sync(); err != nil {
+		temporary.Close()
+		return err
+	}
+	if err = temporary.Chmod(perm); err != nil {
+		temporary.Close()
+		return err
+	}
+	if err = temporary.Close(); err != nil {
+		return err
+	}
+	return os.Rename(temporary.Name(), path)
+}
@@ -0,0 +1,279 @@
+package dislaunch
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// Discord's own module updater can rewrite `discord_desktop_core`
+// whenever it likes, e.g. replacing `index.js` or creating a whole
+// new version directory, which silently drops the injected client
+// mod. On a fresh install, `discord_desktop_core` doesn't even exist
+// until Discord has run once. So, the watcher uses inotify to watch
+// each directory along the way to `discord_desktop_core` and
+// reinjects the client mod whenever it's been lost.
+
+// Discord writes several files when updating a module, so the
+// check is only run once things have settled down
+const reinjectionDelay = 2 * time.Second
+
+// After a reinjection fails, e.g. because the client mod can't be
+// downloaded, the next waits for this long, doubling with each
+// further failure up to the maximum, rather than trying (and
+// spending GitHub API requests) every time the directory changes
+const (
+	reinjectionBackoff    = time.Minute
+	maxReinjectionBackoff = time.Hour
+)
+
+const watchMask = unix.IN_CREATE | unix.IN_MOVED_TO | unix.IN_MOVED_FROM | unix.IN_DELETE | unix.IN_CLOSE_WRITE
+
+type watcher struct {
+	mu      sync.Mutex
+	fd      int
+	config  string
+	watches map[int32]*release // `nil` for the config directory itself
+	timers  map[*release]*time.Timer
+	// consecutive failed reinjections, and when the next may be tried
+	failures map[*release]int
+	retries  map[*release]time.Time
+}
+
+// `isOwnFile` reports whether `name` is one of the files the daemon
+// itself writes into `discord_desktop_core` whilst injecting, which
+// would otherwise set the watcher off again
+func isOwnFile(name string) bool {
+	return name == indexJsBackupName || strings.HasPrefix(name, ".dislaunch-") || strings.HasSuffix(name, ".part")
+}
+
+func (watcher *watcher) add(path string, release *release) {
+	wd, err := unix.InotifyAddWatch(watcher.fd, path, watchMask)
+	if err != nil {
+		// most likely doesn't exist yet, in which case its parent is being watched for it
+		return
+	}
+
+	watcher.mu.Lock()
+	watcher.watches[int32(wd)] = release
+	watcher.mu.Unlock()
+}
+
+// `watch` adds watches for whichever of the directories leading to
+// the release's `discord_desktop_core` exist. Watching a directory
+// that's already watched is harmless, so this can be called freely.
+func (watcher *watcher) watch(release *release) {
+	userData := filepath.Join(watcher.config, strings.ToLower(release.pathName))
+	watcher.add(userData, release)
+
+	state := release.getState()
+	if state.Version == "" {
+		return
+	}
+
+	core, err := release.getCoreModulePath(state.Version)
+	if err != nil {
+		return
+	}
+	modules := filepath.Dir(core)
+	for _, path := range []string{filepath.Dir(modules), modules, core} {
+		watcher.add(path, release)
+	}
+}
+
+// `getReinjectionReason` returns why the client mod needs to be
+// reinjected, or an empty string if it doesn't
+func (release *release) getReinjectionReason(state *releaseState) string {
+	if state.Status != statusNone || state.Internal == nil || !state.Internal.BdEnabled || state.Version == "" {
+		return ""
+	}
+
+	injector, err := getInjector(state.Internal.Injector)
+	if err != nil {
+		return ""
+	}
+
+	core, err := release.getCoreModulePath(state.Version)
+	if err != nil {
+		return ""
+	}
+
+	// Discord hasn't finished installing the module yet, and will write `index.js` once it has
+	if _, err = os.Stat(filepath.Join(core, "core.asar")); err != nil {
+		return ""
+	}
+
+	if !injector.isInstalled(core) {
+		return injector.name() + " was removed from " + core
+	}
+
+	indexJs, err := os.ReadFile(filepath.Join(core, "index.js"))
+	if err != nil {
+		return "index.js is unreadable: " + err.Error()
+	}
+	if !bytes.Equal(indexJs, []byte(injector.shim())) {
+		return "index.js was rewritten"
+	}
+
+	return ""
+}
+
+// `reinjectBd` is `applyBd`, but first checks under the lock that
+// reinjecting is still necessary and records why it was
+func (release *release) reinjectBd() (result error) {
+	internal, reset, err := release.takeOver()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		result = reset()
+	}()
+
+	state := release.getState()
+	reason := release.getReinjectionReason(&releaseState{
+		Internal: internal,
+		Version:  state.Version,
+	})
+	if reason == "" {
+		return
+	}
+
+	log.Printf("Reinjecting client mod into %s: %s\n", release, reason)
+	release.lastReinjection = time.Now()
+	release.reinjectionReason = reason
+	release.injectBd(internal, false)
+	return
+}
+
+func (watcher *watcher) check(release *release) {
+	watcher.mu.Lock()
+	defer watcher.mu.Unlock()
+
+	delay := max(reinjectionDelay, time.Until(watcher.retries[release]))
+	if timer, exists := watcher.timers[release]; exists {
+		timer.Reset(delay)
+		return
+	}
+
+	watcher.timers[release] = time.AfterFunc(delay, func() {
+		watcher.mu.Lock()
+		delete(watcher.timers, release)
+		watcher.mu.Unlock()
+
+		// new directories may have appeared, e.g. for a new version
+		watcher.watch(release)
+		if release.getReinjectionReason(release.getState()) == "" {
+			return
+		}
+		_, err := release.run("reinject_bd", releaseParams{Release: release.id}, processResult(release.reinjectBd))
+
+		watcher.mu.Lock()
+		if err == nil {
+			delete(watcher.failures, release)
+			delete(watcher.retries, release)
+			watcher.mu.Unlock()
+			return
+		}
+		watcher.failures[release]++
+		backoff := min(reinjectionBackoff<<min(watcher.failures[release]-1, 16), maxReinjectionBackoff)
+		watcher.retries[release] = time.Now().Add(backoff)
+		watcher.mu.Unlock()
+
+		log.Printf("Reinjecting client mod into %s failed - trying again in %s\n", release, backoff)
+		watcher.check(release)
+	})
+}
+
+func (watcher *watcher) handle(event *unix.InotifyEvent, name string) {
+	if event.Mask&unix.IN_IGNORED != 0 {
+		watcher.mu.Lock()
+		delete(watcher.watches, event.Wd)
+		watcher.mu.Unlock()
+		return
+	}
+
+	watcher.mu.Lock()
+	watched, exists := watcher.watches[event.Wd]
+	watcher.mu.Unlock()
+	if !exists {
+		return
+	}
+
+	if watched != nil {
+		if !isOwnFile(name) {
+			watcher.check(watched)
+		}
+		return
+	}
+
+	// an event in the config directory itself, which matters only if
+	// it's the configuration file or a release's user data directory
+	if name == configurationFileName {
+		reloadConfiguration()
+		return
+	}
+	for _, release := range []*release{getStable(), getPtb(), getCanary()} {
+		if name == strings.ToLower(release.pathName) {
+			watcher.check(release)
+		}
+	}
+}
+
+func startWatcher() {
+	config, err := os.UserConfigDir()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error getting user config directory for watcher: %s\n", err)
+		return
+	}
+
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error initialising inotify: %s\n", err)
+		return
+	}
+	defer unix.Close(fd)
+
+	watcher := &watcher{
+		fd:       fd,
+		config:   config,
+		watches:  make(map[int32]*release),
+		timers:   make(map[*release]*time.Timer),
+		failures: make(map[*release]int),
+		retries:  make(map[*release]time.Time),
+	}
+
+	watcher.add(config, nil)
+	for _, release := range []*release{getStable(), getPtb(), getCanary()} {
+		watcher.watch(release)
+		// the injection may have been lost while the daemon wasn't running
+		watcher.check(release)
+	}
+
+	buffer := make([]byte, 64*(unix.SizeofInotifyEvent+unix.NAME_MAX+1))
+	for {
+		n, err := unix.Read(fd, buffer)
+		if err != nil {
+			if err == unix.EINTR {
+				continue
+			}
+			fmt.Fprintf(os.Stderr, "error reading inotify events: %s\n", err)
+			return
+		}
+
+		for offset := 0; offset+unix.SizeofInotifyEvent <= n; {
+			event := (*unix.InotifyEvent)(unsafe.Pointer(&buffer[offset]))
+			nameStart := offset + unix.SizeofInotifyEvent
+			name := string(bytes.TrimRight(buffer[nameStart:nameStart+int(event.Len)], "\x00"))
+			watcher.handle(event, name)
+			offset = nameStart + int(event.Len)
+		}
+	}
+}
@@ -44,7 +44,7 @@ public ConfigurationPage (Adw.ApplicationWindow application_window) {
 	default_install_path_row = new FolderEntryRow (
 		application_window,
 		File.new_build_filename (Environment.get_user_data_dir (), "io.github.Fohqul.Dislaunch"),
-		(path) => Socket.command ("config default_install_path " + path)
+		(path) => Socket.command ("config default_install_path " + Shell.quote (path))
 		) {
 		title = "Default install path",
 		tooltip_text =
@@ -2,17 +2,51 @@ void usage (string name) {
 	stdout.printf ("%s - Send commands to the Dislaunch daemon\n\n", name);
 	stdout.printf ("%s {stable|ptb|canary} <command>\n", name);
 	stdout.printf ("command:\n");
+	stdout.printf (
+		"\tautostart {0|1} - Sets whether Discord should be launched through Dislaunch when logging in.\n");
+	stdout.printf (
+		"\tautostart_minimized {0|1} - Sets whether Discord should start minimized when launched on login. Has no effect when autostart is disabled.\n");
+	stdout.printf (
+		"\tbd_apply [--force] - Injects BetterDiscord if enabled, or restores Discord's original index.js if not. --force overwrites index.js even if something else has modified it.\n");
+	stdout.printf (
+		"\tbd_changelog - Gets the release notes of each BetterDiscord release since the installed one, up to the latest.\n");
 	stdout.printf (
 		"\tbd_channel {stable|canary} - Sets the BetterDiscord release channel to use when BetterDiscord is enabled.\n");
-	stdout.printf ("\tbd_enabled {0|1} - Sets whether Dislaunch should inject BetterDiscord.\n");
+	stdout.printf ("\tbd_enabled {0|1} - Sets whether Dislaunch should inject BetterDiscord (or whichever client mod is set by injector.)\n");
+	stdout.printf (
+		"\tbd_pin <tag> - Pins BetterDiscord to the release tagged <tag>, ignoring bd_channel until bd_unpin is run.\n");
+	stdout.printf ("\tbd_unpin - Unpins BetterDiscord, following bd_channel again.\n");
 	stdout.printf (
 		"\tcheck_for_updates - Check whether any updates to Discord and BetterDiscord are available. Does not by itself install updates.\n");
 	stdout.printf (
-		"\tcommand_line_arguments <args> - Sets the command-line arguments Dislaunch should execute Discord with.\n");
+		"\tcommand_line_arguments <args> - Sets the command-line arguments Dislaunch should execute Discord with. Arguments are quoted as in a POSIX shell.\n");
+	stdout.printf (
+		"\tenvironment <name>[=<value>] - Sets the environment variable <name> Dislaunch should execute Discord with, or unsets it if no value is given.\n");
+	stdout.printf (
+		"\tinjector {betterdiscord|vencord} - Sets which client mod Dislaunch should inject when bd_enabled is set. Defaults to betterdiscord.\n");
+	stdout.printf (
+		"\tinspect [archive...] - Checks that Discord's app.asar and core.asar, the client mod and index.js are intact, along with any given asar archives, whose entries are also listed.\n");
 	stdout.printf (
 		"\tinstall - Installs the latest version of Discord. If it is already installed, update it if any update is available (check_for_update must be run first.)\n");
 	stdout.printf ("\tmove <path> - Move the path in which Discord is installed to <path>.\n");
-	stdout.printf ("\tuninstall - Uninstalls this release of Discord.\n\n");
+	stdout.printf (
+		"\topen_asar {0|1} - Sets whether Dislaunch should replace Discord's app.asar with OpenAsar. The original is restored when disabled.\n");
+	stdout.printf (
+		"\tuninstall [--trash] [--dry-run] [--purge[=<scopes>]] - Uninstalls this release of Discord. --trash moves it to the trash instead of deleting it, whereas --dry-run only reports what would be removed. --purge also removes data left behind, optionally only for the given comma-separated scopes: bd, modules, user_data, cache, state.\n");
+	stdout.printf (
+		"\twrapper [command] - Sets a command such as gamemoderun or prime-run through which Dislaunch should execute Discord, or unsets it if none is given.\n\n");
+	stdout.printf ("%s addon <command>\n", name);
+	stdout.printf ("command:\n");
+	stdout.printf (
+		"\tinstall {plugin|theme} <source> - Installs a BetterDiscord plugin or theme from <source>, either a URL or a GitHub repository as owner/repository.\n");
+	stdout.printf ("\tlist - Lists installed BetterDiscord plugins and themes along with their sources and versions.\n");
+	stdout.printf ("\tremove <name> - Removes the BetterDiscord plugin or theme called <name>.\n");
+	stdout.printf (
+		"\tupdate [name] - Updates the BetterDiscord plugin or theme called <name>, or all of them if none is given. Also done alongside automatically_check_for_updates.\n\n");
+	stdout.printf ("%s operation <command>\n", name);
+	stdout.printf ("command:\n");
+	stdout.printf (
+		"\tcancel <id> - Cancels the operation with ID <id>, such as an install or a move. If it is still queued behind another operation, it is removed from the queue.\n\n");
 	stdout.printf ("%s config <command>\n", name);
 	stdout.printf ("command:\n");
 	stdout.printf (
@@ -21,8 +55,12 @@ void usage (string name) {
 		"\tnotify_on_update_available {0|1} - Send a notification if an update is available. Has no effect when automatically_check_for_updates is disabled.\n");
 	stdout.printf (
 		"\tautomatically_install_updates {0|1} - Automatically update Discord when an update is available. Has no effect when automatically_check_for_updates is disabled.\n");
+	stdout.printf (
+		"\tgithub_token [token] - Sets the GitHub token used to check for BetterDiscord updates, or unsets it if none is given. Overridden by the DISLAUNCH_GITHUB_TOKEN and GITHUB_TOKEN environment variables.\n");
 	stdout.printf (
 		"\tdefault_install_path <path> - Sets the default path to which Dislaunch should install new releases of Discord. Has no effect on already installed releases - those must be moved with their respective move command.\n");
+	stdout.printf (
+		"\tmax_broadcast_rate <rate> - Sets the most times per second the daemon sends its state to clients whilst it's changing, e.g. during downloads. 0 restores the default of 10.\n");
 }
 
 int main (string[] args) {
@@ -35,7 +73,11 @@ int main (string[] args) {
 	// TODO stop doing this hack and implement a real CLI
 	Socket.start ();
 	Thread.usleep (50000);
-	Socket.command (string.joinv (" ", args[1 :]));
+	// the daemon splits commands as a shell would, so each argument must be quoted to reach it as-is
+	string[] quoted_args = {};
+	foreach (var arg in args[1 :])
+		quoted_args += Shell.quote (arg);
+	Socket.command (string.joinv (" ", quoted_args));
 
 	return Posix.EXIT_SUCCESS;
 }
\ No newline at end of file
@@ -1,4 +1,4 @@
-int launch (ReleaseChannel channel) {
+int launch (ReleaseChannel channel, string[] extra_arguments) {
 	var status = new Progress (channel).run ();
 	if (status != Posix.EXIT_SUCCESS)
 		stderr.printf (
@@ -23,26 +23,23 @@ int launch (ReleaseChannel channel) {
 
 	var executable = "%s/%s/%s".printf (state.internal.install_path, path_name, path_name);
 
-	string[] command_line_arguments;
-	if (state.internal.command_line_arguments != "")
-		try {
-			Shell.parse_argv (state.internal.command_line_arguments, out command_line_arguments);
-		} catch (ShellError e) {
-			stderr.printf (
-				"Failed to parse command-line arguments '%s': %s\n",
-				state.internal.command_line_arguments, e.message
-			);
-			command_line_arguments = {};
-		}
-	else
-		command_line_arguments = {};
+	var command_line_arguments = state.internal.command_line_arguments;
+	var wrapper = state.internal.wrapper;
+
+	state.internal.environment.foreach ((name, value) => Environment.set_variable (name, value, true));
 
-	var argv = new string[command_line_arguments.length + 1];
-	argv[0] = executable;
-	for (size_t i = 0; i < command_line_arguments.length; ++i)
-		argv[i + 1] = command_line_arguments[i];
+	// When there's a wrapper, e.g. `gamemoderun`, it's the wrapper that's executed, which in turn executes Discord
+	// Extra arguments are passed through as-is, e.g. `--start-minimized` from the autostart entry
+	string[] argv = {};
+	foreach (var argument in wrapper)
+		argv += argument;
+	argv += executable;
+	foreach (var argument in command_line_arguments)
+		argv += argument;
+	foreach (var argument in extra_arguments)
+		argv += argument;
 
-	Posix.execv (executable, argv);
+	Posix.execvp (argv[0], argv);
 
 	stderr.printf ("Failed to launch " + channel.title + ": %s\n", strerror (errno));
 	return Posix.EXIT_FAILURE;
@@ -59,11 +56,11 @@ int main (string[] args) {
 
 	switch (args[1]) {
 	case "stable":
-		return launch (ReleaseChannel.STABLE);
+		return launch (ReleaseChannel.STABLE, args[2 :]);
 	case "ptb":
-		return launch (ReleaseChannel.PTB);
+		return launch (ReleaseChannel.PTB, args[2 :]);
 	case "canary":
-		return launch (ReleaseChannel.CANARY);
+		return launch (ReleaseChannel.CANARY, args[2 :]);
 	default:
 		stderr.printf ("Unknown argument: %s\n", args[1]);
 		return Posix.EXIT_FAILURE;
@@ -236,6 +236,9 @@ private void refresh (SocketState state) {
 	case "bd_injection":
 		status.label = "Injecting BetterDiscord";
 		break;
+	case "open_asar":
+		status.label = "Installing OpenAsar";
+		break;
 	case "move":
 		status.label = "Moving";
 		break;
@@ -60,7 +60,7 @@ public Release (Adw.ApplicationWindow application_window, ReleaseChannel channel
 	install_path_row = new FolderEntryRow (
 		application_window,
 		File.new_build_filename (Environment.get_user_state_dir (), "io.github.Fohqul.Dislaunch"),
-		(path) => Socket.command ("%s move %s".printf (channel.id, path))
+		(path) => Socket.command ("%s move %s".printf (channel.id, Shell.quote (path)))
 		) {
 		title = "Install Path"
 	};
@@ -213,8 +213,13 @@ private void refresh (ReleaseState state) {
 	if (install_path_row.text != state.internal.install_path)
 		install_path_row.text = state.internal.install_path;
 
-	if (command_line_arguments_row.text != state.internal.command_line_arguments)
-		command_line_arguments_row.text = state.internal.command_line_arguments;
+	// Only quote arguments which need it so that what the user typed is shown back to them as-is
+	string[] quoted_arguments = {};
+	foreach (var argument in state.internal.command_line_arguments)
+		quoted_arguments += Regex.match_simple ("^[A-Za-z0-9_@%+=:,./-]+$", argument) ? argument : Shell.quote (argument);
+	var command_line_arguments = string.joinv (" ", quoted_arguments);
+	if (command_line_arguments_row.text != command_line_arguments)
+		command_line_arguments_row.text = command_line_arguments;
 
 	uninstall_progress_row.progress_bar.visible = false;
 	uninstall_button.sensitive = true;
@@ -238,8 +243,13 @@ private void refresh (ReleaseState state) {
 	}
 	bd_channel_row.notify["selected"].connect (bd_channel_row_selected);
 	bd_apply_progress_row.progress_bar.visible = false;
-	bd_apply_row.subtitle = state.internal.bd_latest_release != null &&
-		state.internal.bd_installed_release != state.internal.bd_latest_release ? "Update available" : "";
+	if (state.internal.bd_latest_release != null &&
+		state.internal.bd_installed_release != state.internal.bd_latest_release)
+		bd_apply_row.subtitle = state.internal.bd_installed_tag != "" ?
+			"Update available: %s → %s".printf (state.internal.bd_installed_tag, state.internal.bd_latest_tag) :
+			"Update available";
+	else
+		bd_apply_row.subtitle = state.internal.bd_installed_tag;
 	bd_apply_button.sensitive = true;
 
 	view_stack.visible_child_name = "preferences";
@@ -260,6 +270,7 @@ private void refresh (ReleaseState state) {
 		update_button.label = state.status == "update_check" ? "Checking…" : "Updating…";
 		break;
 	case "bd_injection":
+	case "open_asar":
 		bd_apply_progress_row.progress_bar.progress = state.progress;
 		bd_apply_progress_row.progress_bar.text = text;
 		break;
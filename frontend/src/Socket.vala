@@ -7,11 +7,15 @@ public struct ReleaseInternal {
 	string install_path;
 	DateTime last_checked;
 	string latest_version;
-	string command_line_arguments;
+	string[] command_line_arguments;
+	HashTable<string, string> environment;
+	string[] wrapper;
 	bool bd_enabled;
 	string bd_channel;
 	int64? bd_installed_release;
 	int64? bd_latest_release;
+	string bd_installed_tag;
+	string bd_latest_tag;
 }
 
 public struct ReleaseState {
@@ -212,6 +216,53 @@ private Value parse_value (Json.Object object, string member, Type type) throws
 	return node.get_value ();
 }
 
+private string[] parse_string_array (Json.Object object, string member) throws SocketError {
+	if (!object.has_member (member))
+		return {};
+
+	var node = object.get_member (member);
+	if (node.get_node_type () != Json.NodeType.ARRAY)
+		throw new SocketError.INVALID_RESPONSE ("not an array: %d", node.get_node_type ());
+
+	string[] array = {};
+	foreach (var element in node.get_array ().get_elements ()) {
+		if (element.get_node_type () != Json.NodeType.VALUE || element.get_value_type () != Type.STRING)
+			throw new SocketError.INVALID_RESPONSE ("array '%s' contains a non-string", member);
+		array += element.get_string ();
+	}
+	return array;
+}
+
+private HashTable<string, string> parse_string_object (Json.Object object, string member) throws SocketError {
+	var table = new HashTable<string, string> (str_hash, str_equal);
+	if (!object.has_member (member))
+		return table;
+
+	var node = object.get_member (member);
+	if (node.get_node_type () != Json.NodeType.OBJECT)
+		throw new SocketError.INVALID_RESPONSE ("not an object: %d", node.get_node_type ());
+
+	foreach (var name in node.get_object ().get_members ()) {
+		var value = node.get_object ().get_member (name);
+		if (value.get_node_type () != Json.NodeType.VALUE || value.get_value_type () != Type.STRING)
+			throw new SocketError.INVALID_RESPONSE ("object '%s' contains a non-string", member);
+		table[name] = value.get_string ();
+	}
+	return table;
+}
+
+// only the tag is needed of the BetterDiscord release descriptions
+private string parse_bd_release_tag (Json.Object object, string member) throws SocketError {
+	if (!object.has_member (member) || object.get_null_member (member))
+		return "";
+
+	var node = object.get_member (member);
+	if (node.get_node_type () != Json.NodeType.OBJECT)
+		throw new SocketError.INVALID_RESPONSE ("not an object: %d", node.get_node_type ());
+
+	return parse_value (node.get_object (), "tag", Type.STRING).get_string ();
+}
+
 private void parse_release (Json.Object parent_object, string channel, out ReleaseState state) throws SocketError {
 	if (!parent_object.has_member (channel))
 		throw new SocketError.INVALID_RESPONSE ("release '%s' is absent", channel);
@@ -265,10 +316,9 @@ private void parse_release (Json.Object parent_object, string channel, out Relea
 	if (last_checked != "" && state.internal.last_checked == null)
 		throw new SocketError.INVALID_RESPONSE ("`last_checked` is not a valid DateTime: %s", last_checked);
 	state.internal.latest_version = parse_value (internal_object, "latest_version", Type.STRING).get_string ();
-	state.internal.command_line_arguments = parse_value (
-		internal_object, "command_line_arguments",
-		Type.STRING
-	).get_string ();
+	state.internal.command_line_arguments = parse_string_array (internal_object, "command_line_arguments");
+	state.internal.environment = parse_string_object (internal_object, "environment");
+	state.internal.wrapper = parse_string_array (internal_object, "wrapper");
 	state.internal.bd_enabled = parse_value (internal_object, "bd_enabled", Type.BOOLEAN).get_boolean ();
 	var bd_channel = parse_value (internal_object, "bd_channel", Type.STRING).get_string ();
 	if (bd_channel != "stable" && bd_channel != "canary")
@@ -279,6 +329,8 @@ private void parse_release (Json.Object parent_object, string channel, out Relea
 		Type.INT64
 	).get_int64 ();
 	state.internal.bd_latest_release = parse_value (internal_object, "bd_latest_release", Type.INT64).get_int64 ();
+	state.internal.bd_installed_tag = parse_bd_release_tag (internal_object, "bd_installed");
+	state.internal.bd_latest_tag = parse_bd_release_tag (internal_object, "bd_latest");
 	// } catch (Error e) {
 	// critical = e;
 	// }
@@ -293,6 +345,10 @@ private void handle_message (string message) {
 			throw new SocketError.INVALID_RESPONSE ("invalid root type: %d", root.get_node_type ());
 
 		var root_object = root.get_object ();
+		// anything else (e.g. the daemon's hello and responses) is JSON-RPC, which isn't used here yet
+		if (root_object.has_member ("jsonrpc"))
+			return;
+
 		BackendState backend_state = {};
 
 		parse_release (root_object, "stable", out backend_state.stable);